@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const KEY_PREFIX = "xc_"
+
+var (
+	ErrMissingKey = errors.New("missing API key")
+	ErrInvalidKey = errors.New("invalid or revoked API key")
+)
+
+// APIKey is one issued key; only the SHA-256 of the secret is ever stored
+type APIKey struct {
+	ID        string    `json:"id"`
+	Hash      string    `json:"hash"`
+	Owners    []string  `json:"owners"`
+	Tier      string    `json:"tier,omitempty"`
+	Admin     bool      `json:"admin,omitempty"` // may change the mappings shared by every owner
+	CreatedAt time.Time `json:"created_at"`
+	Revoked   bool      `json:"revoked"`
+}
+
+// Authorizes checks if the key may convert feeds for the given owner email
+func (k *APIKey) Authorizes(ownerEmail string) bool {
+	for _, owner := range k.Owners {
+		if strings.EqualFold(owner, ownerEmail) {
+			return true
+		}
+	}
+	return false
+}
+
+// Store keeps the keys in a JSON file, reloading it when another process (the CLI) changes it
+type Store struct {
+	path    string
+	mu      sync.RWMutex
+	keys    []APIKey
+	modTime time.Time
+}
+
+// NewStore opens the key file; a missing file is an empty store
+func NewStore(path string) (*Store, error) {
+	store := &Store{path: path}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Issue creates a new key for the owners and returns the plain secret, shown only once
+func (s *Store) Issue(owners []string, tier string, admin bool) (string, APIKey, error) {
+	if len(owners) == 0 && !admin {
+		return "", APIKey{}, errors.New("at least one owner email is required")
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", APIKey{}, err
+	}
+	secret := KEY_PREFIX + hex.EncodeToString(secretBytes)
+
+	// The ID is shown on lists and logs: its own random bytes, nothing of the secret
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", APIKey{}, err
+	}
+
+	key := APIKey{
+		ID:        hex.EncodeToString(idBytes),
+		Hash:      hashKey(secret),
+		Owners:    owners,
+		Tier:      tier,
+		Admin:     admin,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+	if err := s.save(); err != nil {
+		return "", APIKey{}, err
+	}
+	return secret, key, nil
+}
+
+// Revoke disables a key by its ID
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.keys {
+		if s.keys[i].ID == id {
+			s.keys[i].Revoked = true
+			return s.save()
+		}
+	}
+	return fmt.Errorf("key '%s' not found", id)
+}
+
+// List returns a copy of every key
+func (s *Store) List() []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]APIKey(nil), s.keys...)
+}
+
+// Authenticate resolves the key sent on the request (Authorization: Bearer or X-API-Key)
+func (s *Store) Authenticate(r *http.Request) (*APIKey, error) {
+	secret := RequestKey(r)
+	if secret == "" {
+		return nil, ErrMissingKey
+	}
+
+	s.refresh()
+
+	hash := hashKey(secret)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.Hash == hash && !key.Revoked {
+			found := key
+			return &found, nil
+		}
+	}
+	return nil, ErrInvalidKey
+}
+
+// RequestKey extracts the raw key from the request headers
+func RequestKey(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+//------------------------------------------------------------------- Helpers
+
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// refresh reloads the file if it changed since the last read
+func (s *Store) refresh() {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return
+	}
+	s.mu.RLock()
+	changed := info.ModTime().After(s.modTime)
+	s.mu.RUnlock()
+	if changed {
+		if err := s.load(); err != nil {
+			slog.Error("error reloading API keys", "error", err)
+		}
+	}
+}
+
+func (s *Store) load() error {
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return fmt.Errorf("Error reading API keys file: %v", err)
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+	return nil
+}
+
+// save writes the keys atomically; callers hold the lock
+func (s *Store) save() error {
+	content, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
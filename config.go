@@ -0,0 +1,240 @@
+package main
+
+import (
+	"go-test/logging"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings, all of them overridable by environment variables
+type Config struct {
+	Addr string
+
+	// API keys
+	AuthEnabled bool
+	KeysFile    string
+
+	// Upload limits
+	MaxCompressedBytes   int64
+	MaxDecompressedBytes int64
+	MaxCompressionRatio  int64
+	MaxXMLDepth          int
+	MaxXMLElements       int
+
+	// Validation
+	StrictValidation bool
+	PostalCodesFile  string
+
+	// Indent the converted files
+	PrettyOutput bool
+
+	// Extra attribute definitions on top of the built in registry
+	AttributesFile string
+
+	// Values mapped on the mapping editor
+	SynonymsFile string
+
+	// Extra offer type synonyms (raw value -> venda, arrendamento or trespasse)
+	OfferTypesFile string
+
+	// Converted adverts returned by a dry run
+	DryRunPreview int
+
+	// Inferred categories under this confidence are flagged on the report
+	CategoryMinConfidence float64
+
+	// Images kept per advert (0 for all of them) and HEAD checks of every image
+	MaxImages         int
+	CheckImages       bool
+	ImageCheckTimeout time.Duration
+
+	// Copies of the images on our storage, served on /images/ (or by whatever serves MirrorBaseURL)
+	MirrorImages          bool
+	MirrorDir             string
+	MirrorBaseURL         string
+	MirrorConcurrency     int
+	MirrorMaxBytes        int64
+	MirrorThumbnailWidths []int
+	MirrorTimeout         time.Duration
+	MirrorRevalidateAfter time.Duration // agencies replace photos on the same URL
+
+	// Element of the 3D tours (Matterport) when Rosetta takes them, left out while empty
+	VirtualTourElement string
+
+	// Title and description cleanup
+	DescriptionFormat    string
+	DescriptionTags      string
+	RedactContacts       bool
+	MaxTitleLength       int // 0 for no limit, the portal documents none
+	MaxDescriptionLength int // 0 for no limit
+
+	// Uploads, outputs and reports kept for the dashboard, outside history/ where the package lives
+	HistoryDir  string
+	HistoryKeep int
+
+	// Rate limiting and concurrency
+	RateTiers     string
+	MaxConcurrent int
+	QueueSize     int
+	QueueTimeout  time.Duration
+
+	// Logging
+	Logging logging.Config
+
+	// Server timeouts
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+}
+
+// LoadConfig reads the configuration from the environment falling back to the defaults
+func LoadConfig() Config {
+	return Config{
+		Addr: envString("CONVERT_ADDR", ":8080"),
+
+		AuthEnabled: envString("CONVERT_AUTH", "on") != "off",
+		KeysFile:    envString("CONVERT_KEYS_FILE", "keys.json"),
+
+		MaxCompressedBytes:   envInt64("CONVERT_MAX_COMPRESSED_BYTES", 20<<20),
+		MaxDecompressedBytes: envInt64("CONVERT_MAX_DECOMPRESSED_BYTES", 200<<20),
+		MaxCompressionRatio:  envInt64("CONVERT_MAX_COMPRESSION_RATIO", 100),
+		MaxXMLDepth:          int(envInt64("CONVERT_MAX_XML_DEPTH", 32)),
+		MaxXMLElements:       int(envInt64("CONVERT_MAX_XML_ELEMENTS", 2000000)),
+
+		StrictValidation: envString("CONVERT_STRICT_VALIDATION", "off") == "on",
+		PostalCodesFile:  envString("CONVERT_POSTAL_CODES_FILE", ""),
+		AttributesFile:   envString("CONVERT_ATTRIBUTES_FILE", ""),
+		SynonymsFile:     envString("CONVERT_SYNONYMS_FILE", "synonyms.json"),
+		OfferTypesFile:   envString("CONVERT_OFFER_TYPES_FILE", ""),
+		PrettyOutput:     envString("CONVERT_PRETTY_OUTPUT", "off") == "on",
+		DryRunPreview:    int(envInt64("CONVERT_DRY_RUN_PREVIEW", 3)),
+
+		CategoryMinConfidence: envFloat("CONVERT_CATEGORY_MIN_CONFIDENCE", 0.6),
+
+		MaxImages:         envLimit("CONVERT_MAX_IMAGES", 50),
+		CheckImages:       envString("CONVERT_CHECK_IMAGES", "off") == "on",
+		ImageCheckTimeout: envDuration("CONVERT_IMAGE_CHECK_TIMEOUT", 5*time.Second),
+
+		MirrorImages:          envString("CONVERT_MIRROR_IMAGES", "off") == "on",
+		MirrorDir:             envString("CONVERT_MIRROR_DIR", "images"),
+		MirrorBaseURL:         envString("CONVERT_MIRROR_BASE_URL", ""),
+		MirrorConcurrency:     int(envInt64("CONVERT_MIRROR_CONCURRENCY", 8)),
+		MirrorMaxBytes:        envInt64("CONVERT_MIRROR_MAX_BYTES", 15<<20),
+		MirrorThumbnailWidths: envIntList("CONVERT_MIRROR_THUMBNAIL_WIDTHS", []int{320, 800}),
+		MirrorTimeout:         envDuration("CONVERT_MIRROR_TIMEOUT", 30*time.Second),
+		MirrorRevalidateAfter: envDuration("CONVERT_MIRROR_REVALIDATE_AFTER", 24*time.Hour),
+
+		VirtualTourElement: envString("CONVERT_VIRTUAL_TOUR_ELEMENT", ""),
+
+		DescriptionFormat:    envString("CONVERT_DESCRIPTION_FORMAT", "html"),
+		DescriptionTags:      envString("CONVERT_DESCRIPTION_TAGS", "p,br,b,strong,i,em,u,ul,ol,li"),
+		RedactContacts:       envString("CONVERT_REDACT_CONTACTS", "on") == "on",
+		MaxTitleLength:       envLimit("CONVERT_MAX_TITLE_LENGTH", 0),
+		MaxDescriptionLength: envLimit("CONVERT_MAX_DESCRIPTION_LENGTH", 10000),
+
+		HistoryDir:  envString("CONVERT_HISTORY_DIR", "conversions"),
+		HistoryKeep: int(envInt64("CONVERT_HISTORY_KEEP", 50)),
+
+		RateTiers:     envString("CONVERT_RATE_TIERS", "default=0.2:5,premium=1:20"),
+		MaxConcurrent: int(envInt64("CONVERT_MAX_CONCURRENT", 4)),
+		QueueSize:     int(envInt64("CONVERT_QUEUE_SIZE", 16)),
+		QueueTimeout:  envDuration("CONVERT_QUEUE_TIMEOUT", 30*time.Second),
+
+		Logging: logging.Config{
+			Level:           envString("CONVERT_LOG_LEVEL", "info"),
+			Format:          envString("CONVERT_LOG_FORMAT", "text"),
+			Output:          envString("CONVERT_LOG_OUTPUT", "stdout"),
+			MappingFile:     envString("CONVERT_MAPPING_LOG", "mapping.log"),
+			MappingMaxBytes: envInt64("CONVERT_MAPPING_LOG_MAX_BYTES", 10<<20),
+			MappingBackups:  int(envInt64("CONVERT_MAPPING_LOG_BACKUPS", 5)),
+		},
+
+		ReadHeaderTimeout: envDuration("CONVERT_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       envDuration("CONVERT_READ_TIMEOUT", 60*time.Second),
+		WriteTimeout:      envDuration("CONVERT_WRITE_TIMEOUT", 120*time.Second),
+		IdleTimeout:       envDuration("CONVERT_IDLE_TIMEOUT", 120*time.Second),
+	}
+}
+
+//------------------------------------------------------------------- Helpers
+
+func envString(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt64(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed <= 0 {
+		slog.Warn("invalid value, using default", "variable", name, "value", value)
+		return fallback
+	}
+	return parsed
+}
+
+// envLimit is envInt64 for the limits where 0 turns the limit off
+func envLimit(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		slog.Warn("invalid value, using default", "variable", name, "value", value)
+		return fallback
+	}
+	return parsed
+}
+
+func envFloat(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		slog.Warn("invalid value, using default", "variable", name, "value", value)
+		return fallback
+	}
+	return parsed
+}
+
+func envIntList(name string, fallback []int) []int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	var parsed []int
+	for _, item := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || number <= 0 {
+			slog.Warn("invalid value, using default", "variable", name, "value", value)
+			return fallback
+		}
+		parsed = append(parsed, number)
+	}
+	return parsed
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		slog.Warn("invalid value, using default", "variable", name, "value", value)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"go-test/convert_to_json"
+	"go-test/convert_to_rosetta"
+	"go-test/report"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files in testdata/golden")
+
+// TestConversionGolden runs every feed in testdata/feeds through the pipeline and compares
+// the Rosetta XML and the report with testdata/golden. Run with -update to regenerate them.
+func TestConversionGolden(t *testing.T) {
+	feeds, err := filepath.Glob(filepath.Join("testdata", "feeds", "*.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) == 0 {
+		t.Fatal("no feeds found in testdata/feeds")
+	}
+
+	for _, feed := range feeds {
+		name := strings.TrimSuffix(filepath.Base(feed), ".xml")
+		t.Run(name, func(t *testing.T) {
+			rosettaXML, conversionReport := convertTestFeed(t, feed)
+
+			reportJSON, err := json.MarshalIndent(conversionReport, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			compareGolden(t, filepath.Join("testdata", "golden", name+".xml"), rosettaXML)
+			compareGolden(t, filepath.Join("testdata", "golden", name+".report.json"), string(reportJSON)+"\n")
+		})
+	}
+}
+
+// TestConversionDeterministic makes sure the same feed always gives byte identical output
+func TestConversionDeterministic(t *testing.T) {
+	feed := filepath.Join("testdata", "feeds", "accented_values.xml")
+	first, _ := convertTestFeed(t, feed)
+	for i := 0; i < 20; i++ {
+		if again, _ := convertTestFeed(t, feed); again != first {
+			t.Fatalf("run %d produced a different output", i)
+		}
+	}
+}
+
+//-------------------------------------------------------------------- Helpers
+
+func convertTestFeed(t *testing.T, path string) (string, *report.Report) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conversionReport := report.New()
+	jsonData, err := convert_to_json.ConvertXMLToJSON(content, conversionReport)
+	if err != nil {
+		t.Fatalf("ConvertXMLToJSON: %v", err)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		t.Fatalf("decoding JSON: %v", err)
+	}
+
+	rosettaXML, err := convert_to_rosetta.ConvertJSONToRosetta(result, convert_to_rosetta.Options{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Report: conversionReport,
+		Pretty: true,
+	})
+	if err != nil {
+		t.Fatalf("ConvertJSONToRosetta: %v", err)
+	}
+
+	return rosettaXML, conversionReport
+}
+
+func compareGolden(t *testing.T, path string, got string) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file, run go test -run TestConversionGolden -update: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the output, run with -update and review the diff\n--- got\n%s", path, got)
+	}
+}
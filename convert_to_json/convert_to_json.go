@@ -1,9 +1,12 @@
 package convert_to_json
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"go-test/report"
+	"strings"
 )
 
 type User struct {
@@ -31,15 +34,17 @@ type Advert struct {
 	PostalCode       string      `xml:"postal_code"`
 	Category         string      `xml:"category"`
 	OfferType        string      `xml:"offer_type"`
-	Title            string      `xml:"title"`
+	Title            string      `xml:"-"` // main text of Titles: the Portuguese one, else the untagged one
+	Titles           []Text      `xml:"title"`
 	Price            string      `xml:"price"`
 	Area             string      `xml:"area"`
 	AreaGround       string      `xml:"area_ground"`
 	Size             string      `xml:"size"`
-	Images           []string    `xml:"images>image"`
+	Images           []Image     `xml:"images>image"`
 	MovieURL         string      `xml:"movie_url"`
 	ReferenceID      string      `xml:"reference_id"`
-	Description      string      `xml:"description"`
+	Description      string      `xml:"-"` // main text of Descriptions, like Title
+	Descriptions     []Text      `xml:"description"`
 	ConsultantEmail  string      `xml:"consultant_email"`
 	Year             string      `xml:"year"`
 	NumOfUserLicence string      `xml:"number_of_user_license"`
@@ -47,6 +52,19 @@ type Advert struct {
 	Attributes       []Attribute `xml:"attributes>attribute"`
 }
 
+// Text is a <title> or <description>, lang="en" when the agency says the language
+type Text struct {
+	Lang string `xml:"lang,attr"`
+	Text string `xml:",chardata"`
+}
+
+// Image is one <image>; order="n" and main="true" are optional
+type Image struct {
+	URL   string `xml:",chardata"`
+	Order string `xml:"order,attr"`
+	Main  string `xml:"main,attr"`
+}
+
 type Attribute struct {
 	Name  string `xml:"name"`
 	Value string `xml:"value"`
@@ -59,13 +77,39 @@ type Data struct {
 	Adverts     []Advert     `xml:"advert"`
 }
 
-func ConvertXMLToJSON(xmlContent []byte) ([]byte, error) {
+func ConvertXMLToJSON(xmlContent []byte, conversionReport *report.Report) ([]byte, error) {
+	// Detect the charset and make sure the parser only sees UTF-8
+	detected, err := DetectEncoding(xmlContent)
+	if err != nil {
+		return nil, fmt.Errorf("Error detecting encoding: %v", err)
+	}
+	conversionReport.Encoding = detected.Name
+	conversionReport.EncodingSource = detected.Source
+
+	utf8Content, err := TranscodeToUTF8(xmlContent, detected)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse absurdly nested or huge documents before building the structs
+	if err := CheckXMLLimits(utf8Content); err != nil {
+		return nil, err
+	}
+
 	var data Data
-	err := xml.Unmarshal(xmlContent, &data)
+	decoder := xml.NewDecoder(bytes.NewReader(utf8Content))
+	decoder.CharsetReader = alreadyUTF8CharsetReader
+	err = decoder.Decode(&data)
 	if err != nil {
 		return nil, fmt.Errorf("Error unmarshalling XML: %v", err)
 	}
 
+	// The single title and description the rest of the mapping reads
+	for i := range data.Adverts {
+		data.Adverts[i].Title = mainText(data.Adverts[i].Titles)
+		data.Adverts[i].Description = mainText(data.Adverts[i].Descriptions)
+	}
+
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return nil, fmt.Errorf("Error marshalling JSON: %v", err)
@@ -73,3 +117,27 @@ func ConvertXMLToJSON(xmlContent []byte) ([]byte, error) {
 
 	return jsonData, nil
 }
+
+// mainText picks the Portuguese text, else the first untagged one; a text tagged in another language is only
+// the fallback when the advert has neither, so it never takes the Portuguese slot ahead of them
+func mainText(texts []Text) string {
+	var untagged, first string
+	for _, text := range texts {
+		if strings.TrimSpace(text.Text) == "" {
+			continue
+		}
+		lang := strings.ToLower(strings.TrimSpace(text.Lang))
+		switch {
+		case lang == "pt" || strings.HasPrefix(lang, "pt-") || strings.HasPrefix(lang, "pt_"):
+			return text.Text
+		case lang == "" && untagged == "":
+			untagged = text.Text
+		case first == "":
+			first = text.Text
+		}
+	}
+	if untagged != "" {
+		return untagged
+	}
+	return first
+}
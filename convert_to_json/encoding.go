@@ -0,0 +1,101 @@
+package convert_to_json
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	ENCODING_SOURCE_BOM         = "bom"
+	ENCODING_SOURCE_DECLARATION = "declaration"
+	ENCODING_SOURCE_HEURISTIC   = "heuristic"
+)
+
+var xmlDeclarationEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*?encoding\s*=\s*["']([A-Za-z0-9._:\-]+)["']`)
+
+// DetectedEncoding describes the charset used by a feed
+type DetectedEncoding struct {
+	Name     string
+	Source   string
+	encoding encoding.Encoding
+}
+
+// DetectEncoding finds out the charset of a feed: BOM first, then the XML declaration and, if none of them helps, a heuristic
+func DetectEncoding(xmlContent []byte) (DetectedEncoding, error) {
+	// Byte order marks
+	switch {
+	case bytes.HasPrefix(xmlContent, []byte{0xEF, 0xBB, 0xBF}):
+		return DetectedEncoding{Name: "UTF-8", Source: ENCODING_SOURCE_BOM, encoding: unicode.UTF8BOM}, nil
+	case bytes.HasPrefix(xmlContent, []byte{0xFF, 0xFE}):
+		return DetectedEncoding{Name: "UTF-16LE", Source: ENCODING_SOURCE_BOM, encoding: unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)}, nil
+	case bytes.HasPrefix(xmlContent, []byte{0xFE, 0xFF}):
+		return DetectedEncoding{Name: "UTF-16BE", Source: ENCODING_SOURCE_BOM, encoding: unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)}, nil
+	}
+
+	// Encoding declared on <?xml ... encoding="..."?>
+	if match := xmlDeclarationEncoding.FindSubmatch(xmlContent); match != nil {
+		label := string(match[1])
+		declared, name, err := lookupEncoding(label)
+		if err != nil {
+			return DetectedEncoding{}, err
+		}
+
+		// CRMs often declare UTF-8 and then export Latin-1 anyway
+		if name == "UTF-8" && !utf8.Valid(xmlContent) {
+			return DetectedEncoding{Name: "windows-1252", Source: ENCODING_SOURCE_HEURISTIC, encoding: charmap.Windows1252}, nil
+		}
+		return DetectedEncoding{Name: name, Source: ENCODING_SOURCE_DECLARATION, encoding: declared}, nil
+	}
+
+	// No hints at all: valid UTF-8 or else the usual Windows-1252 (superset of ISO-8859-1)
+	if utf8.Valid(xmlContent) {
+		return DetectedEncoding{Name: "UTF-8", Source: ENCODING_SOURCE_HEURISTIC, encoding: unicode.UTF8}, nil
+	}
+	return DetectedEncoding{Name: "windows-1252", Source: ENCODING_SOURCE_HEURISTIC, encoding: charmap.Windows1252}, nil
+}
+
+// TranscodeToUTF8 converts the feed content to UTF-8 using the detected encoding
+func TranscodeToUTF8(xmlContent []byte, detected DetectedEncoding) ([]byte, error) {
+	if detected.encoding == nil || detected.encoding == unicode.UTF8 {
+		return xmlContent, nil
+	}
+
+	decoded, err := detected.encoding.NewDecoder().Bytes(xmlContent)
+	if err != nil {
+		return nil, fmt.Errorf("Error transcoding from %s: %v", detected.Name, err)
+	}
+	return decoded, nil
+}
+
+// lookupEncoding resolves an encoding label using the WHATWG index first and IANA names second
+func lookupEncoding(label string) (encoding.Encoding, string, error) {
+	if enc, err := htmlindex.Get(label); err == nil {
+		name, _ := htmlindex.Name(enc)
+		if strings.EqualFold(name, "utf-8") {
+			return unicode.UTF8, "UTF-8", nil
+		}
+		return enc, name, nil
+	}
+
+	if enc, err := ianaindex.IANA.Encoding(label); err == nil && enc != nil {
+		name, _ := ianaindex.IANA.Name(enc)
+		return enc, name, nil
+	}
+
+	return nil, "", fmt.Errorf("Unsupported encoding '%s'", label)
+}
+
+// alreadyUTF8CharsetReader is used after transcoding, when the declaration still names the original charset
+func alreadyUTF8CharsetReader(label string, input io.Reader) (io.Reader, error) {
+	return input, nil
+}
@@ -0,0 +1,57 @@
+package convert_to_json
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Structural limits applied to every feed before decoding it
+var (
+	MaxXMLDepth    = 32
+	MaxXMLElements = 2000000
+)
+
+// XMLLimitError is returned when a feed is nested too deep or has too many elements
+type XMLLimitError struct {
+	Limit string
+	Max   int
+}
+
+func (e *XMLLimitError) Error() string {
+	return fmt.Sprintf("XML %s exceeds the maximum of %d", e.Limit, e.Max)
+}
+
+// CheckXMLLimits walks the tokens of a UTF-8 feed counting elements and nesting depth
+func CheckXMLLimits(xmlContent []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(xmlContent))
+	decoder.CharsetReader = alreadyUTF8CharsetReader
+
+	depth := 0
+	elements := 0
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Syntax errors are reported by the real decoding step
+			return nil
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+			elements++
+			if depth > MaxXMLDepth {
+				return &XMLLimitError{Limit: "depth", Max: MaxXMLDepth}
+			}
+			if elements > MaxXMLElements {
+				return &XMLLimitError{Limit: "element count", Max: MaxXMLElements}
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
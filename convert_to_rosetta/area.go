@@ -0,0 +1,132 @@
+package convert_to_rosetta
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	TERRAIN_AREA_URN = "urn:concept:terrain-area-m2"
+	USABLE_AREA_URN  = "urn:concept:usable-area-m2"
+
+	AREA_TYPE_OLD = "tipo_de_area"
+)
+
+// "1.200,5 m2", "120m²", "2 ha", "0,5 hectares"...
+var areaPattern = regexp.MustCompile(`^([0-9][0-9.,\s]*)\s*([a-z²][a-z0-9²]*)?\.?$`)
+
+// areaUnits are the multipliers to square metres
+var areaUnits = map[string]float64{
+	"":         1,
+	"m":        1,
+	"m2":       1,
+	"m²":       1,
+	"mt2":      1,
+	"mts2":     1,
+	"metros":   1,
+	"sqm":      1,
+	"ha":       10000,
+	"hectare":  10000,
+	"hectares": 10000,
+	"km2":      1000000,
+	"km²":      1000000,
+	"a":        100,
+	"ares":     100,
+}
+
+// Categories where the main area is the land itself
+var terrainCategories = map[string]bool{
+	"terrenos":           true,
+	"quintas_e_herdades": true,
+}
+
+// ParseArea reads an area in any of the usual formats and returns it in square metres
+func ParseArea(raw string) (float64, bool) {
+	value := strings.ToLower(strings.TrimSpace(raw))
+	value = strings.ReplaceAll(value, "metros quadrados", "m2")
+	match := areaPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, false
+	}
+
+	multiplier, known := areaUnits[match[2]]
+	if !known {
+		return 0, false
+	}
+
+	// Hectares and square kilometres come with decimals: "1,500 ha" is one hectare and a half
+	number, ok := parseNumber(strings.ReplaceAll(match[1], " ", ""), multiplier > 1)
+	if !ok || number <= 0 {
+		return 0, false
+	}
+
+	return number * multiplier, true
+}
+
+// FormatArea writes square metres with at most two decimals
+func FormatArea(m2 float64) string {
+	return strconv.FormatFloat(math.Round(m2*100)/100, 'f', -1, 64)
+}
+
+// AreaTargetURN decides where the main area of an advert goes: the explicit area type wins, then the category
+func AreaTargetURN(category string, areaType string) string {
+	switch SanitizeString(strings.TrimSpace(areaType)) {
+	case "util", "area_util", "usable":
+		return USABLE_AREA_URN
+	case "bruta", "area_bruta", "gross":
+		return GROSS_AREA_URN
+	case "terreno", "area_de_terreno", "area_terreno", "terrain", "land":
+		return TERRAIN_AREA_URN
+	}
+
+	if terrainCategories[SanitizeString(category)] {
+		return TERRAIN_AREA_URN
+	}
+	return GROSS_AREA_URN
+}
+
+// parseDecimal understands both "1.200,5" (Portuguese) and "1,200.5" (English) grouping
+func parseDecimal(number string) (float64, bool) {
+	return parseNumber(number, false)
+}
+
+// parseNumber is parseDecimal where a single separator is always the decimal one when decimalUnit is set
+func parseNumber(number string, decimalUnit bool) (float64, bool) {
+	lastDot := strings.LastIndex(number, ".")
+	lastComma := strings.LastIndex(number, ",")
+
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// The last separator is the decimal one
+		if lastComma > lastDot {
+			number = strings.ReplaceAll(number, ".", "")
+			number = strings.Replace(number, ",", ".", 1)
+		} else {
+			number = strings.ReplaceAll(number, ",", "")
+		}
+	case lastComma >= 0:
+		if strings.Count(number, ",") > 1 || (!decimalUnit && isThousandsGroup(number, lastComma)) {
+			number = strings.ReplaceAll(number, ",", "")
+		} else {
+			number = strings.Replace(number, ",", ".", 1)
+		}
+	case lastDot >= 0:
+		if strings.Count(number, ".") > 1 || (!decimalUnit && isThousandsGroup(number, lastDot)) {
+			number = strings.ReplaceAll(number, ".", "")
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+	return parsed, true
+}
+
+// isThousandsGroup tells if a single separator is followed by exactly three digits ("1.200", "3,500");
+// never after a zero integer part, "0,500" is a half
+func isThousandsGroup(number string, separator int) bool {
+	return len(number)-separator-1 == 3 && separator > 0 && strings.Trim(number[:separator], "0") != ""
+}
@@ -0,0 +1,41 @@
+package convert_to_rosetta
+
+import "testing"
+
+func TestParseArea(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want float64
+		ok   bool
+	}{
+		// Thousands groups and decimals, Portuguese and English
+		{"1.200 m2", 1200, true},
+		{"3.500,75", 3500.75, true},
+		{"1,200.5 m2", 1200.5, true},
+		{"65,5 m²", 65.5, true},
+		{"120m²", 120, true},
+		{"250 metros quadrados", 250, true},
+
+		// Hectares take decimals, even with three of them
+		{"1,5 ha", 15000, true},
+		{"0,500 ha", 5000, true},
+		{"1.500 ha", 15000, true},
+		{"0,5 hectares", 5000, true},
+		{"2 ha", 20000, true},
+
+		// A zero integer part is never a thousands group
+		{"0,500", 0.5, true},
+
+		{"", 0, false},
+		{"0 m2", 0, false},
+		{"3 acres", 0, false},
+		{"sob consulta", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := ParseArea(test.raw)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ParseArea(%q) = %v, %v, want %v, %v", test.raw, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package convert_to_rosetta
+
+import (
+	"fmt"
+	"go-test/report"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Where the category of an advert came from
+const (
+	CATEGORY_SOURCE_FEED       = "category"   // the <category> of the feed, found on the table
+	CATEGORY_SOURCE_KEYWORDS   = "keywords"   // title, description, attributes and typology
+	CATEGORY_SOURCE_OFFER_TYPE = "offer_type" // nothing to go on, generic for sale / for rent
+)
+
+// CategoryMinConfidence is the confidence under which an inferred category is flagged on the report
+var CategoryMinConfidence = 0.6
+
+// CategoryGuess is the category an advert ends up with and how sure we are about it
+type CategoryGuess struct {
+	Category   string  // key of GetCategoryList ("moradias"...), "" for the generic URN
+	URN        string  // what goes on <category_urn>
+	Confidence float64 // 0 to 1, 1 when the feed category is on the table
+	Source     string  // CATEGORY_SOURCE_*
+	Vacation   bool    // holiday rental keywords found
+}
+
+// Points of a keyword found on the title; on the description and attributes it counts 1
+const TITLE_KEYWORD_WEIGHT = 3
+
+// Evidence needed for full confidence: one keyword on the title
+const CATEGORY_FULL_EVIDENCE = 3.0
+
+// categoryKeywords are matched on whole words of the unaccented lowercase text
+var categoryKeywords = map[string][]string{
+	"apartamentos":              {"apartamento", "apartamentos", "apto", "flat", "penthouse", "duplex", "estudio", "studio", "loft", "andar"},
+	"moradias":                  {"moradia", "moradias", "vivenda", "casa", "villa", "chalet", "bungalow", "casa de campo", "townhouse"},
+	"terrenos":                  {"terreno", "terrenos", "lote", "lotes", "loteamento"},
+	"lojas":                     {"loja", "lojas", "espaco comercial", "estabelecimento comercial"},
+	"armazens":                  {"armazem", "armazens", "pavilhao", "pavilhao industrial", "nave industrial"},
+	"garagens_e_estacionamento": {"garagem", "garagens", "estacionamento", "lugar de garagem", "parqueamento"},
+	"escritorios":               {"escritorio", "escritorios", "consultorio", "gabinete"},
+	"predios":                   {"predio", "predios", "edificio"},
+	"quintas_e_herdades":        {"quinta", "quintas", "herdade", "herdades", "monte alentejano"},
+	"quartos":                   {"quarto para arrendar", "quarto para estudante", "quartos para estudantes", "arrendo quarto", "quarto individual", "quarto duplo"},
+	"trespasse":                 {"trespasse", "trespassa se"},
+}
+
+// Holiday rental words; the category becomes the "para ferias" one of apartments and houses
+var vacationKeywords = []string{"ferias", "alojamento local", "holiday", "vacation", "temporada", "por noite", "aluguer de curta duracao", "short term"}
+
+// Phrases with a keyword that say nothing about the category ("casa de banho" is a bathroom)
+var ignoredPhrases = []string{"casa de banho", "casas de banho", "casa das maquinas"}
+
+var (
+	wordSplitPattern = regexp.MustCompile(`[^a-z0-9]+`)
+	typologyPattern  = regexp.MustCompile(`\b([tv])\s?(\d{1,2})(?:\s?\+\s?\d)?\b`)
+)
+
+// ResolveCategory returns the category of the advert: the feed one when it is known, inferred otherwise
+func ResolveCategory(advert map[string]interface{}) CategoryGuess {
+	offerType, known := NormalizeOfferType(StringField(advert, "OfferType"))
+	if !known {
+		// No way to tell sale from rent: the caller rejects the advert
+		return CategoryGuess{Source: CATEGORY_SOURCE_OFFER_TYPE}
+	}
+	if offerType == OFFER_TYPE_TRANSFER {
+		return CategoryGuess{Category: "trespasse", URN: MapCategoryURN(OFFER_TYPE_TRANSFER, ""), Confidence: 1, Source: CATEGORY_SOURCE_FEED}
+	}
+
+	if category := SanitizeString(StringField(advert, "Category")); category != "" {
+		if urn := MapCategoryURN(StringField(advert, "OfferType"), StringField(advert, "Category")); urn != "" {
+			return CategoryGuess{Category: category, URN: urn, Confidence: 1, Source: CATEGORY_SOURCE_FEED}
+		}
+	}
+
+	guess := ClassifyCategory(StringField(advert, "Title"), advertText(advert), StringField(advert, "Size"))
+	categories := GetCategoryList()[offerType]
+
+	// Holiday rentals are only apartments and houses for rent
+	if guess.Vacation && offerType == OFFER_TYPE_RENT && (guess.Category == "apartamentos" || guess.Category == "moradias") {
+		guess.Category += "_para_ferias"
+	}
+
+	if urn, exists := categories[guess.Category]; exists {
+		guess.URN = urn
+		return guess
+	}
+
+	// Nothing recognizable (or not on the table for this offer type): the generic URN
+	generic := CategoryGuess{Source: CATEGORY_SOURCE_OFFER_TYPE, URN: "urn:concept:realestate-for-rent", Vacation: guess.Vacation}
+	if offerType == OFFER_TYPE_SALE {
+		generic.URN = "urn:concept:realestate-for-sale"
+	}
+	return generic
+}
+
+// ClassifyCategory scores every category on the keywords of the title, of the rest of the text and on the typology
+func ClassifyCategory(title string, text string, typology string) CategoryGuess {
+	title = normalizeText(title)
+	text = normalizeText(text)
+
+	scores := map[string]float64{}
+	for category, keywords := range categoryKeywords {
+		for _, keyword := range keywords {
+			if containsWords(title, keyword) {
+				scores[category] += TITLE_KEYWORD_WEIGHT
+			} else if containsWords(text, keyword) {
+				scores[category]++
+			}
+		}
+	}
+
+	// "V3" is a house, "T3" a house or an apartment, more often an apartment
+	if matches := typologyPattern.FindAllStringSubmatch(normalizeText(typology)+title, -1); len(matches) > 0 {
+		villa := false
+		for _, match := range matches {
+			villa = villa || match[1] == "v"
+		}
+		if villa {
+			scores["moradias"] += 2
+		} else {
+			scores["apartamentos"] += 0.5
+			scores["moradias"] += 0.25
+		}
+	}
+
+	guess := CategoryGuess{Source: CATEGORY_SOURCE_KEYWORDS}
+	for _, keyword := range vacationKeywords {
+		if containsWords(title, keyword) || containsWords(text, keyword) {
+			guess.Vacation = true
+			break
+		}
+	}
+
+	// Highest score wins, ties broken by name so the result is stable
+	categories := make([]string, 0, len(scores))
+	total := 0.0
+	for category, score := range scores {
+		categories = append(categories, category)
+		total += score
+	}
+	if total == 0 {
+		return guess
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if scores[categories[i]] != scores[categories[j]] {
+			return scores[categories[i]] > scores[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+
+	best := scores[categories[0]]
+	guess.Category = categories[0]
+
+	// Share of the evidence the winner has, times how much evidence there is
+	guess.Confidence = best / total
+	if best < CATEGORY_FULL_EVIDENCE {
+		guess.Confidence *= best / CATEGORY_FULL_EVIDENCE
+	}
+	guess.Confidence = math.Round(guess.Confidence*100) / 100
+	return guess
+}
+
+//-------------------------------------------------------------------- Helpers
+
+// advertText joins the description and the attribute values the classifier reads besides the title
+func advertText(advert map[string]interface{}) string {
+	parts := []string{StringField(advert, "Description"), StringField(advert, "Category")}
+	attributesSlice, _ := advert["Attributes"].([]interface{})
+	for _, attr := range attributesSlice {
+		if attribute, isMap := attr.(map[string]interface{}); isMap {
+			parts = append(parts, StringField(attribute, "Value"))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// normalizeText lowercases, removes the accents and leaves single spaces between words (and around them)
+func normalizeText(text string) string {
+	words := strings.Fields(wordSplitPattern.ReplaceAllString(RemoveAccent(strings.ToLower(text)), " "))
+	normalized := " " + strings.Join(words, " ") + " "
+	for _, phrase := range ignoredPhrases {
+		normalized = strings.ReplaceAll(normalized, " "+phrase+" ", " ")
+	}
+	return normalized
+}
+
+// containsWords looks for the keyword as whole words of the normalized text
+func containsWords(normalized string, keyword string) bool {
+	return strings.Contains(normalized, " "+keyword+" ")
+}
+
+// categoryIssue tells the agency the category was not taken from the feed, as a warning when we are not sure about it
+func categoryIssue(advert map[string]interface{}, guess CategoryGuess) (report.Issue, bool) {
+	if guess.Source == CATEGORY_SOURCE_FEED {
+		return report.Issue{}, false
+	}
+
+	issue := report.Issue{
+		Level:      report.LEVEL_INFO,
+		Code:       ISSUE_CATEGORY_INFERRED,
+		Message:    fmt.Sprintf("Category missing or unknown, inferred '%s' from the title and description (confidence %.2f)", guess.URN, guess.Confidence),
+		Field:      "category",
+		Value:      StringField(advert, "Category"),
+		ExternalID: StringField(advert, "ExternalID"),
+	}
+	if guess.Source == CATEGORY_SOURCE_OFFER_TYPE {
+		issue.Level = report.LEVEL_WARNING
+		issue.Code = ISSUE_CATEGORY_UNCERTAIN
+		issue.Message = fmt.Sprintf("Category missing or unknown and not recognizable from the text, published as '%s'", guess.URN)
+	} else if guess.Confidence < CategoryMinConfidence {
+		issue.Level = report.LEVEL_WARNING
+		issue.Code = ISSUE_CATEGORY_UNCERTAIN
+	}
+	return issue, true
+}
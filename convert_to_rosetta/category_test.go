@@ -0,0 +1,69 @@
+package convert_to_rosetta
+
+import "testing"
+
+func TestResolveCategory(t *testing.T) {
+	tests := []struct {
+		offerType   string
+		category    string
+		title       string
+		description string
+		size        string
+		urn         string
+		source      string
+		confident   bool
+	}{
+		// Known categories come straight from the table
+		{"Venda", "Moradias", "Apartamento T2", "", "", "urn:concept:houses-for-sale", CATEGORY_SOURCE_FEED, true},
+		{"Arrendamento", "Quartos", "", "", "", "urn:concept:rooms-for-rent", CATEGORY_SOURCE_FEED, true},
+
+		// Offer type synonyms, a business transfer is always goodwill
+		{"For rent", "Moradias", "", "", "", "urn:concept:houses-for-rent", CATEGORY_SOURCE_FEED, true},
+		{"Aluguer", "", "Apartamento T2", "", "T2", "urn:concept:apartments-for-rent", CATEGORY_SOURCE_KEYWORDS, true},
+		{"Trespasse", "Lojas", "Restaurante", "", "", "urn:concept:goodwill", CATEGORY_SOURCE_FEED, true},
+		{"Permuta", "Moradias", "", "", "", "", CATEGORY_SOURCE_OFFER_TYPE, false},
+
+		// Keywords on the title
+		{"Venda", "", "Moradia T3 em Seia", "", "T3", "urn:concept:houses-for-sale", CATEGORY_SOURCE_KEYWORDS, true},
+		{"Venda", "Imóveis", "Apartamento T1 no centro do Porto", "", "T1", "urn:concept:apartments-for-sale", CATEGORY_SOURCE_KEYWORDS, true},
+		{"Venda", "", "Terreno urbano com 1200 m2", "", "", "urn:concept:lots-for-sale", CATEGORY_SOURCE_KEYWORDS, true},
+		{"Arrendamento", "", "Loja na Baixa", "Espaço comercial com montra", "", "urn:concept:stores-for-rent", CATEGORY_SOURCE_KEYWORDS, true},
+		{"Venda", "", "Herdade no Alentejo", "", "", "urn:concept:farms-and-estates-for-sale", CATEGORY_SOURCE_KEYWORDS, true},
+		{"Arrendamento", "", "Quarto para estudante em Coimbra", "", "", "urn:concept:rooms-for-rent", CATEGORY_SOURCE_KEYWORDS, true},
+
+		// "casa de banho" is not a house
+		{"Venda", "", "Excelente T2", "Cozinha equipada e duas casas de banho", "T2", "urn:concept:apartments-for-sale", CATEGORY_SOURCE_KEYWORDS, false},
+
+		// V typology is a house
+		{"Venda", "", "V4 com piscina", "", "", "urn:concept:houses-for-sale", CATEGORY_SOURCE_KEYWORDS, true},
+
+		// Holiday rentals
+		{"Arrendamento", "", "Apartamento para férias no Algarve", "", "", "urn:concept:apartments-for-vacation", CATEGORY_SOURCE_KEYWORDS, true},
+		{"Arrendamento", "", "Moradia junto à praia", "Alojamento local, preço por noite", "", "urn:concept:houses-for-vacation", CATEGORY_SOURCE_KEYWORDS, true},
+		{"Venda", "", "Apartamento em zona de férias", "", "", "urn:concept:apartments-for-sale", CATEGORY_SOURCE_KEYWORDS, true},
+
+		// Only a weak hint in the description
+		{"Venda", "", "Oportunidade", "Perto de garagem pública", "", "urn:concept:garages-for-sale", CATEGORY_SOURCE_KEYWORDS, false},
+
+		// Nothing to go on
+		{"Venda", "Outros", "Oportunidade", "Boa localização", "", "urn:concept:realestate-for-sale", CATEGORY_SOURCE_OFFER_TYPE, false},
+		{"Arrendamento", "", "", "", "", "urn:concept:realestate-for-rent", CATEGORY_SOURCE_OFFER_TYPE, false},
+	}
+
+	for _, test := range tests {
+		advert := map[string]interface{}{
+			"OfferType":   test.offerType,
+			"Category":    test.category,
+			"Title":       test.title,
+			"Description": test.description,
+			"Size":        test.size,
+		}
+		guess := ResolveCategory(advert)
+		if guess.URN != test.urn || guess.Source != test.source {
+			t.Errorf("ResolveCategory(%q, %q, %q) = %s from %s, want %s from %s", test.offerType, test.category, test.title, guess.URN, guess.Source, test.urn, test.source)
+		}
+		if confident := guess.Confidence >= CategoryMinConfidence; confident != test.confident {
+			t.Errorf("ResolveCategory(%q, %q, %q) confidence = %.2f, want confident %v", test.offerType, test.category, test.title, guess.Confidence, test.confident)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package convert_to_rosetta
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Certificate statuses
+const (
+	CERTIFICATE_STATUS_CLASS          = "class"
+	CERTIFICATE_STATUS_EXEMPT         = "exempt"
+	CERTIFICATE_STATUS_NOT_APPLICABLE = "not_applicable"
+	CERTIFICATE_STATUS_IN_PROGRESS    = "in_progress"
+	CERTIFICATE_STATUS_UNKNOWN        = "unknown"
+)
+
+// SCE certificate numbers: "SCE0000123456789", "SCE 123456789", "CE123456789"
+var certificateNumberPattern = regexp.MustCompile(`(?i)\b(?:SCE|CE)\s?\d{6,16}\b|\b\d{9,16}\b`)
+
+// Prefixes agencies write before the class
+var certificatePrefixPattern = regexp.MustCompile(`^(?:certificado energetico|certificado|classe energetica|classe|categoria|cat\.?|ce)\s*[:.]?\s*`)
+
+// Certificate is the normalized energy certificate of an advert
+type Certificate struct {
+	Class  string // Rosetta value ("aplus", "bminus", "isento"...), empty when there is none
+	Status string
+	Number string
+}
+
+// certificateValues maps the spellings found in the feeds to the status and Rosetta class
+var certificateValues = map[string]Certificate{
+	"a+":       {Class: "aplus", Status: CERTIFICATE_STATUS_CLASS},
+	"a plus":   {Class: "aplus", Status: CERTIFICATE_STATUS_CLASS},
+	"aplus":    {Class: "aplus", Status: CERTIFICATE_STATUS_CLASS},
+	"a":        {Class: "a", Status: CERTIFICATE_STATUS_CLASS},
+	"b":        {Class: "b", Status: CERTIFICATE_STATUS_CLASS},
+	"b-":       {Class: "bminus", Status: CERTIFICATE_STATUS_CLASS},
+	"b minus":  {Class: "bminus", Status: CERTIFICATE_STATUS_CLASS},
+	"b menos":  {Class: "bminus", Status: CERTIFICATE_STATUS_CLASS},
+	"bminus":   {Class: "bminus", Status: CERTIFICATE_STATUS_CLASS},
+	"c":        {Class: "c", Status: CERTIFICATE_STATUS_CLASS},
+	"d":        {Class: "d", Status: CERTIFICATE_STATUS_CLASS},
+	"e":        {Class: "e", Status: CERTIFICATE_STATUS_CLASS},
+	"f":        {Class: "f", Status: CERTIFICATE_STATUS_CLASS},
+	"g":        {Class: "g", Status: CERTIFICATE_STATUS_CLASS},
+	"isento":   {Class: "isento", Status: CERTIFICATE_STATUS_EXEMPT},
+	"isenta":   {Class: "isento", Status: CERTIFICATE_STATUS_EXEMPT},
+	"isencao":  {Class: "isento", Status: CERTIFICATE_STATUS_EXEMPT},
+	"exempt":   {Class: "isento", Status: CERTIFICATE_STATUS_EXEMPT},
+	"exempted": {Class: "isento", Status: CERTIFICATE_STATUS_EXEMPT},
+
+	// Not applicable (ruins, land...) is published as exempt
+	"nao aplicavel":  {Class: "isento", Status: CERTIFICATE_STATUS_NOT_APPLICABLE},
+	"n/a":            {Class: "isento", Status: CERTIFICATE_STATUS_NOT_APPLICABLE},
+	"na":             {Class: "isento", Status: CERTIFICATE_STATUS_NOT_APPLICABLE},
+	"not applicable": {Class: "isento", Status: CERTIFICATE_STATUS_NOT_APPLICABLE},
+
+	// Certificate requested but not issued yet: nothing to publish
+	"em curso":         {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+	"em tramitacao":    {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+	"em processo":      {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+	"em emissao":       {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+	"pendente":         {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+	"in progress":      {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+	"nc":               {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+	"nao certificado":  {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+	"nao classificado": {Status: CERTIFICATE_STATUS_IN_PROGRESS},
+}
+
+// NormalizeCertificate reads the class, the exempt/in progress states and the certificate number from free text
+func NormalizeCertificate(raw string) Certificate {
+	value := strings.TrimSpace(raw)
+
+	// Pull the certificate number out first so it doesn't get in the way of the class
+	number := ""
+	if match := certificateNumberPattern.FindString(value); match != "" {
+		number = strings.ToUpper(strings.ReplaceAll(match, " ", ""))
+		value = strings.Replace(value, match, " ", 1)
+	}
+
+	key := strings.ToLower(RemoveAccent(value))
+	key = strings.ReplaceAll(key, "_", " ")
+	key = strings.Join(strings.Fields(key), " ")
+	key = strings.Trim(key, " :;,.()[]|")
+	key = certificatePrefixPattern.ReplaceAllString(key, "")
+	key = strings.Trim(key, " :;,.()[]|")
+
+	// "B -" and "A +" written with spaces
+	key = strings.Replace(key, " -", "-", 1)
+	key = strings.Replace(key, " +", "+", 1)
+
+	certificate, exists := certificateValues[key]
+	if !exists {
+		certificate = Certificate{Status: CERTIFICATE_STATUS_UNKNOWN}
+	}
+	certificate.Number = number
+	return certificate
+}
@@ -0,0 +1,79 @@
+package convert_to_rosetta
+
+import "testing"
+
+func TestNormalizeCertificate(t *testing.T) {
+	tests := []struct {
+		raw    string
+		class  string
+		status string
+		number string
+	}{
+		// Every SCE class
+		{"A+", "aplus", CERTIFICATE_STATUS_CLASS, ""},
+		{"a+", "aplus", CERTIFICATE_STATUS_CLASS, ""},
+		{"A", "a", CERTIFICATE_STATUS_CLASS, ""},
+		{"B", "b", CERTIFICATE_STATUS_CLASS, ""},
+		{"B-", "bminus", CERTIFICATE_STATUS_CLASS, ""},
+		{"B -", "bminus", CERTIFICATE_STATUS_CLASS, ""},
+		{"C", "c", CERTIFICATE_STATUS_CLASS, ""},
+		{"D", "d", CERTIFICATE_STATUS_CLASS, ""},
+		{"E", "e", CERTIFICATE_STATUS_CLASS, ""},
+		{"F", "f", CERTIFICATE_STATUS_CLASS, ""},
+		{"G", "g", CERTIFICATE_STATUS_CLASS, ""},
+		{"Classe B-", "bminus", CERTIFICATE_STATUS_CLASS, ""},
+		{"Certificado energético: C", "c", CERTIFICATE_STATUS_CLASS, ""},
+
+		// A- is not an SCE class
+		{"A-", "", CERTIFICATE_STATUS_UNKNOWN, ""},
+
+		// Exempt and not applicable
+		{"Isento", "isento", CERTIFICATE_STATUS_EXEMPT, ""},
+		{"isento", "isento", CERTIFICATE_STATUS_EXEMPT, ""},
+		{"Não aplicável", "isento", CERTIFICATE_STATUS_NOT_APPLICABLE, ""},
+		{"nao_aplicavel", "isento", CERTIFICATE_STATUS_NOT_APPLICABLE, ""},
+
+		// In progress
+		{"Em curso", "", CERTIFICATE_STATUS_IN_PROGRESS, ""},
+		{"em_curso", "", CERTIFICATE_STATUS_IN_PROGRESS, ""},
+		{"NC", "", CERTIFICATE_STATUS_IN_PROGRESS, ""},
+		{"Em tramitação", "", CERTIFICATE_STATUS_IN_PROGRESS, ""},
+
+		// Certificate numbers
+		{"B - SCE0000123456789", "bminus", CERTIFICATE_STATUS_CLASS, "SCE0000123456789"},
+		{"A+ (SCE 123456789)", "aplus", CERTIFICATE_STATUS_CLASS, "SCE123456789"},
+		{"SCE123456789", "", CERTIFICATE_STATUS_UNKNOWN, "SCE123456789"},
+		{"D 1234567890", "d", CERTIFICATE_STATUS_CLASS, "1234567890"},
+
+		// Garbage
+		{"", "", CERTIFICATE_STATUS_UNKNOWN, ""},
+		{"H", "", CERTIFICATE_STATUS_UNKNOWN, ""},
+		{"muito bom", "", CERTIFICATE_STATUS_UNKNOWN, ""},
+	}
+
+	for _, test := range tests {
+		got := NormalizeCertificate(test.raw)
+		if got.Class != test.class || got.Status != test.status || got.Number != test.number {
+			t.Errorf("NormalizeCertificate(%q) = %+v, want class %q status %q number %q", test.raw, got, test.class, test.status, test.number)
+		}
+	}
+}
+
+func TestConvertCertificate(t *testing.T) {
+	tests := map[string]string{
+		"A+":       "urn:concept:a-plus",
+		"B":        "urn:concept:b",
+		"B-":       "urn:concept:b-minus",
+		"b-":       "urn:concept:b-minus",
+		"a-":       "",
+		"Isento":   "urn:concept:exempt",
+		"Em curso": "",
+		"":         "",
+	}
+
+	for raw, want := range tests {
+		if got := ConvertCertificate(raw); got != want {
+			t.Errorf("ConvertCertificate(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package convert_to_rosetta
+
+import (
+	"go-test/report"
+	"go-test/validation"
+	"strings"
+)
+
+// Consultant is the contact of an advert: one of the feed consultants or the agency itself
+type Consultant struct {
+	Email string
+	Name  string
+	Phone string // E.164, "" when the feed one is not a phone number
+	Photo string // normalized URL, "" when the feed one is not valid
+}
+
+// ConsultantIndex finds the consultants by lowercase email
+type ConsultantIndex map[string]Consultant
+
+// IndexConsultants reads the consultants of the feed once, normalizing the phones and photos.
+// Problems are reported once here, not on every advert of the consultant.
+func IndexConsultants(fullData map[string]interface{}, conversionReport *report.Report) ConsultantIndex {
+	index := ConsultantIndex{}
+	consultantsData, _ := fullData["Consultants"].([]interface{})
+	for _, data := range consultantsData {
+		consultantMap, isMap := data.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+
+		consultant := Consultant{
+			Email: strings.TrimSpace(StringField(consultantMap, "Email")),
+			Name:  strings.Join(strings.Fields(StringField(consultantMap, "Name")), " "),
+		}
+		key := strings.ToLower(consultant.Email)
+		if key == "" {
+			conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_INVALID_CONSULTANT, Message: "Consultant without an email, no advert can point to it", Field: "consultant", Value: consultant.Name})
+			continue
+		}
+		if _, exists := index[key]; exists {
+			conversionReport.Add(report.Issue{Level: report.LEVEL_INFO, Code: ISSUE_DUPLICATE_CONSULTANT, Message: "Consultant listed more than once, the first one is used", Field: "consultant", Value: consultant.Email})
+			continue
+		}
+
+		if phone := StringField(consultantMap, "Phone"); phone != "" {
+			consultant.Phone = validation.NormalizePhone(phone)
+			if consultant.Phone == "" {
+				conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_INVALID_PHONE, Message: "Phone number of " + consultant.Email + " is not valid, left out", Field: "consultant_phone", Value: phone})
+			}
+		}
+		if photo := StringField(consultantMap, "Photo"); strings.TrimSpace(photo) != "" {
+			normalized, valid := NormalizeImageURL(photo)
+			if valid {
+				consultant.Photo = normalized
+			} else {
+				conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_INVALID_CONSULTANT_PHOTO, Message: "Photo URL of " + consultant.Email + " is not a web address, left out", Field: "consultant_photo", Value: photo})
+			}
+		}
+		index[key] = consultant
+	}
+	return index
+}
+
+// Lookup finds the consultant, the case of the email does not matter
+func (index ConsultantIndex) Lookup(email string) (Consultant, bool) {
+	consultant, found := index[strings.ToLower(strings.TrimSpace(email))]
+	return consultant, found
+}
+
+// AgencyContact is the contact of the "User" block, used when the consultant of an advert is unknown
+func AgencyContact(fullData map[string]interface{}) Consultant {
+	userMap, userExists := fullData["User"].(map[string]interface{})
+	if !userExists {
+		return Consultant{}
+	}
+
+	contact := Consultant{
+		Email: strings.TrimSpace(StringField(userMap, "Email")),
+		Name:  strings.Join(strings.Fields(StringField(userMap, "FirstName")+" "+StringField(userMap, "LastName")), " "),
+		Phone: validation.NormalizePhone(StringField(userMap, "Phone")),
+	}
+	if contact.Name == "" {
+		contact.Name = strings.TrimSpace(StringField(userMap, "CompanyName"))
+	}
+	return contact
+}
+
+// MapConsultant returns the consultant of the advert; a missing or unknown one falls back to the agency contact with a warning
+func MapConsultant(consultantEmail string, index ConsultantIndex, agencyContact Consultant, externalID string, conversionReport *report.Report) (Consultant, bool) {
+	missing := strings.TrimSpace(consultantEmail) == ""
+	if consultant, found := index.Lookup(consultantEmail); found && !missing {
+		return consultant, true
+	}
+
+	reason := "Consultant is not on the feed"
+	if missing {
+		reason = "Advert has no consultant"
+	}
+	issue := report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_UNKNOWN_CONSULTANT, Message: reason + ", the agency contact is used", Field: "consultant_email", Value: consultantEmail, ExternalID: externalID}
+	if agencyContact.Email == "" {
+		issue.Message = reason + " and the agency has no email, the advert has no contact"
+		conversionReport.Add(issue)
+		return Consultant{}, false
+	}
+	conversionReport.Add(issue)
+	return agencyContact, true
+}
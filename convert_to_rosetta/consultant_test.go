@@ -0,0 +1,84 @@
+package convert_to_rosetta
+
+import (
+	"go-test/report"
+	"testing"
+)
+
+func TestIndexConsultants(t *testing.T) {
+	fullData := map[string]interface{}{
+		"Consultants": []interface{}{
+			map[string]interface{}{"Email": " Joana@ARHome.pt ", "Name": "Joana  Sá", "Phone": "912 345 678", "Photo": "http://cdn.arhome.pt/joana.jpg"},
+			map[string]interface{}{"Email": "joana@arhome.pt", "Name": "Joana (repetida)"},
+			map[string]interface{}{"Email": "rui@arhome.pt", "Name": "Rui", "Phone": "ligar para a agência", "Photo": "joana.jpg"},
+			map[string]interface{}{"Name": "Sem email"},
+			"not a consultant",
+		},
+	}
+	conversionReport := report.New()
+	index := IndexConsultants(fullData, conversionReport)
+
+	joana, found := index.Lookup("JOANA@arhome.pt")
+	if !found {
+		t.Fatalf("Lookup of Joana found nothing, index = %+v", index)
+	}
+	want := Consultant{Email: "Joana@ARHome.pt", Name: "Joana Sá", Phone: "+351912345678", Photo: "http://cdn.arhome.pt/joana.jpg"}
+	if joana != want {
+		t.Errorf("Joana = %+v, want %+v", joana, want)
+	}
+	if rui, _ := index.Lookup("rui@arhome.pt"); rui.Phone != "" || rui.Photo != "" {
+		t.Errorf("Rui = %+v, want the invalid phone and photo left out", rui)
+	}
+	if len(index) != 2 {
+		t.Errorf("index has %d consultants, want 2", len(index))
+	}
+
+	var codes []string
+	for _, issue := range conversionReport.Issues {
+		codes = append(codes, issue.Code)
+	}
+	wantCodes := []string{ISSUE_DUPLICATE_CONSULTANT, ISSUE_INVALID_PHONE, ISSUE_INVALID_CONSULTANT_PHOTO, ISSUE_INVALID_CONSULTANT}
+	if len(codes) != len(wantCodes) {
+		t.Fatalf("issues = %v, want %v", codes, wantCodes)
+	}
+	for i := range wantCodes {
+		if codes[i] != wantCodes[i] {
+			t.Errorf("issue %d = %s, want %s", i, codes[i], wantCodes[i])
+		}
+	}
+}
+
+func TestMapConsultant(t *testing.T) {
+	index := ConsultantIndex{"joana@arhome.pt": {Email: "joana@arhome.pt", Name: "Joana Sá"}}
+	agency := AgencyContact(map[string]interface{}{
+		"User": map[string]interface{}{"Email": "geral@arhome.pt", "CompanyName": "AR Home", "Phone": "+351 220 000 000"},
+	})
+	if agency.Name != "AR Home" || agency.Phone != "+351220000000" {
+		t.Errorf("agency contact = %+v, want the company name and the E.164 phone", agency)
+	}
+
+	tests := []struct {
+		email      string
+		agency     Consultant
+		wantEmail  string
+		wantFound  bool
+		wantIssues int
+	}{
+		{"Joana@arhome.pt", agency, "joana@arhome.pt", true, 0},
+		{"", agency, "geral@arhome.pt", true, 1},
+		{" ", Consultant{}, "", false, 1},
+		{"outra@arhome.pt", agency, "geral@arhome.pt", true, 1},
+		{"outra@arhome.pt", Consultant{}, "", false, 1},
+	}
+
+	for _, test := range tests {
+		conversionReport := report.New()
+		consultant, found := MapConsultant(test.email, index, test.agency, "arhme1", conversionReport)
+		if consultant.Email != test.wantEmail || found != test.wantFound {
+			t.Errorf("MapConsultant(%q) = %q, %v, want %q, %v", test.email, consultant.Email, found, test.wantEmail, test.wantFound)
+		}
+		if len(conversionReport.Issues) != test.wantIssues {
+			t.Errorf("MapConsultant(%q) issues = %+v, want %d", test.email, conversionReport.Issues, test.wantIssues)
+		}
+	}
+}
@@ -2,11 +2,15 @@ package convert_to_rosetta
 
 import (
 	"fmt"
+	"go-test/logging"
+	"go-test/metrics"
+	"go-test/mirror"
+	"go-test/report"
+	"go-test/validation"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
-	"log"
-	"net/http"
-	"os"
+	"log/slog"
+	"sort"
 	"strings"
 	"unicode"
 )
@@ -18,7 +22,7 @@ const (
 	CONSTRUCTION_YEAR_URN = "urn:concept:construction-year"
 	BATHROOM_NUM_URN      = "urn:concept:number-of-bathrooms"
 	GROSS_AREA_URN        = "urn:concept:gross-area-m2"
-	CERTIFICATE_URN       = "urn:concept:energy_certificate"
+	CERTIFICATE_URN       = "urn:concept:energy-certificate"
 	ROOMS_NUM_URN         = "urn:concept:number-of-rooms"
 
 	STATE_OLD             = "condicao"
@@ -29,10 +33,37 @@ const (
 	CHARACTERISTICS_OLD   = "caracteristicas"
 )
 
-func ConvertJSONToRosetta(fullData map[string]interface{}, w http.ResponseWriter) (string, error) {
+// Options tunes one conversion
+type Options struct {
+	Logger *slog.Logger
+	Report *report.Report
+
+	// Drop adverts with invalid legal fields (AMI, NIF, postal code, user licence)
+	StrictValidation bool
+
+	// Indent the output; the checksum is always taken from the compact form
+	Pretty bool
+
+	// Dry run: record the category of every advert and keep the first PreviewAdverts converted adverts on the report
+	DryRun         bool
+	PreviewAdverts int
+
+	// HEAD every image and leave out the broken ones; nil skips the checks
+	ImageClient HTTPClient
+
+	// Copy the images to our storage and point <image><url> to the copies; nil (or a dry run) skips it
+	Mirror *mirror.Mirror
+}
+
+func ConvertJSONToRosetta(fullData map[string]interface{}, options Options) (string, error) {
+	logger := options.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	conversionReport := options.Report
 
 	for key, value := range fullData {
-		fmt.Printf("Key: %s, Value: %v\n", key, value)
+		logger.Debug("feed data", "key", key, "value", value)
 	}
 
 	xmlData := ""
@@ -47,64 +78,130 @@ func ConvertJSONToRosetta(fullData map[string]interface{}, w http.ResponseWriter
 	ownerEmail := ConvertOwnerEmail(fullData)
 
 	// Add <owner_email> to header element
-	xmlData += "<owner_email>" + ownerEmail + "</owner_email>"
+	xmlData += "<owner_email>" + EscapeText(ownerEmail) + "</owner_email>"
 
 	// Add <site_urn> to header element
 	xmlData += "<site_urn>" + SITEURN + "</site_urn>"
 
+	// Convert the agency profile from <user>
+	agency := MapAgency(fullData)
+
+	// Add <agency> to header element with the filled fields only
+	if len(agency) > 0 {
+		xmlData += "<agency>"
+		for _, field := range agencyFields {
+			if value, exists := agency[field]; exists {
+				xmlData += "<" + field + ">" + CDATA(value) + "</" + field + ">"
+			}
+		}
+		xmlData += "</agency>"
+	}
+
 	// Close <header> element
 	xmlData += "</header>"
 
 	// Open <adverts> element
 	xmlData += "<adverts>"
 
-	logToFile("\n\n--------------------------------------------------------------------", "-")
+	// Agency legal fields apply to every advert
+	agencyIssues := ValidateAgencyLegalFields(fullData)
+	for _, issue := range agencyIssues {
+		conversionReport.Add(issue)
+	}
 
 	// Iterate through the JSON array and create an <advert> for each item
-	adverts := fullData["Adverts"].([]interface{})
-	for _, data := range adverts {
-		advert := data.(map[string]interface{})
+	adverts, _ := fullData["Adverts"].([]interface{})
+	if conversionReport != nil {
+		conversionReport.DryRun = options.DryRun
+		conversionReport.StrictValidation = options.StrictValidation
+		conversionReport.AdvertCount = len(adverts)
+	}
+	// Consultants looked up by email on every advert, the agency contact when none matches
+	consultants := IndexConsultants(fullData, conversionReport)
+	agencyContact := AgencyContact(fullData)
 
-		// Create the <advert>
-		xmlData += "<advert>"
+	for _, data := range adverts {
+		advert, isMap := data.(map[string]interface{})
+		if !isMap {
+			logger.Warn("advert is not a map[string]interface{}")
+			continue
+		}
 
-		// Get title:
-		title := advert["Title"].(string)
+		// Validate legal fields and, on strict mode, leave the invalid adverts out
+		advertIssues := ValidateAdvertLegalFields(advert)
+		for _, issue := range advertIssues {
+			conversionReport.Add(issue)
+		}
+		if options.StrictValidation && (hasErrors(agencyIssues) || hasErrors(advertIssues)) {
+			externalId, _ := advert["ExternalID"].(string)
+			conversionReport.Reject(externalId)
+			continue
+		}
 
-		// Create <title> element to XML with CDATA
-		xmlData += "<title><![CDATA[" + title + "]]></title>"
+		// Without an offer type there is no telling a sale from a rent: always left out
+		if _, known := NormalizeOfferType(StringField(advert, "OfferType")); !known {
+			externalId := StringField(advert, "ExternalID")
+			conversionReport.Add(report.Issue{Level: report.LEVEL_ERROR, Code: ISSUE_UNKNOWN_OFFER_TYPE, Message: "Offer type is missing or not recognized as a sale, rent or business transfer", Field: "offer_type", Value: StringField(advert, "OfferType"), ExternalID: externalId})
+			conversionReport.Reject(externalId)
+			continue
+		}
 
-		// Get description
-		description := advert["Description"].(string)
+		// Create the <advert>
+		advertStart := len(xmlData)
+		xmlData += "<advert>"
 
-		// Create <description> element to XML with CDATA
-		xmlData += "<description><![CDATA[" + description + "]]></description>"
+		// Titles and descriptions by language, the Portuguese ones first and without lang=""
+		for i, text := range AdvertTexts(advert, StringField(advert, "ExternalID"), conversionReport) {
+			xmlData += MapLocalizedText(text, i == 0, StringField(advert, "ExternalID"), conversionReport)
+		}
 
-		// Convert category
-		category := MapCategoryURN(advert["OfferType"].(string), advert["Category"].(string))
+		// Convert category, inferred from the text when the feed one is missing or unknown
+		categoryGuess := ResolveCategory(advert)
+		category := categoryGuess.URN
+		if options.DryRun {
+			conversionReport.AddCategory(report.CategoryResolution{
+				ExternalID: StringField(advert, "ExternalID"),
+				OfferType:  StringField(advert, "OfferType"),
+				Category:   StringField(advert, "Category"),
+				URN:        category,
+				Confidence: categoryGuess.Confidence,
+				Source:     categoryGuess.Source,
+			})
+		}
+		if issue, flagged := categoryIssue(advert, categoryGuess); flagged {
+			conversionReport.Add(issue)
+		}
+		// Feed categories not on the table; a dry run is the same feed checked before publishing, not counted
+		if !options.DryRun && categoryGuess.Source != CATEGORY_SOURCE_FEED && SanitizeString(StringField(advert, "Category")) != "" {
+			offerType, _ := NormalizeOfferType(StringField(advert, "OfferType"))
+			metrics.CategoryMisses.Inc(offerType)
+		}
 
 		// Create <category_urn> element to XML
-		xmlData += "<category_urn><![CDATA[" + category + "]]></category_urn>"
+		xmlData += "<category_urn>" + CDATA(category) + "</category_urn>"
 
 		// Check if ConsultantEmail exists:
-		consultant := MapConsulterContact(advert["ConsultantEmail"].(string), fullData)
+		consultant, hasContact := MapConsultant(StringField(advert, "ConsultantEmail"), consultants, agencyContact, StringField(advert, "ExternalID"), conversionReport)
 
-		// Create <contact> element to XML case <consultant_email> exists with CDATA
-		if len(consultant) > 0 {
+		// Create <contact> element to XML with CDATA, the agency one when the consultant is missing or unknown
+		if hasContact {
 			xmlData += "<consultant>"
-			xmlData += "<email><![CDATA[" + consultant["email"] + "]]></email>"
-			xmlData += "<name><![CDATA[" + consultant["name"] + "]]></name>"
-			xmlData += "<phone><![CDATA[" + consultant["phone"] + "]]></phone>"
-			xmlData += "<photo><![CDATA[" + consultant["photo"] + "]]></photo>"
+			xmlData += "<email>" + CDATA(consultant.Email) + "</email>"
+			xmlData += "<name>" + CDATA(consultant.Name) + "</name>"
+			xmlData += "<phone>" + CDATA(consultant.Phone) + "</phone>"
+			xmlData += "<photo>" + CDATA(consultant.Photo) + "</photo>"
 			xmlData += "</consultant>"
 		}
 
 		// Convert price:
-		price := MapPrice(advert["Price"].(string))
+		price := MapPrice(StringField(advert, "Price"))
+		if !ValidPrice(price["value"]) {
+			conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_INVALID_PRICE, Message: "Price is missing or not a positive number", Field: "price", Value: price["value"], ExternalID: StringField(advert, "ExternalID")})
+		}
 
 		// Create <price> element to XML
 		xmlData += "<price>"
-		xmlData += "<value>" + price["value"] + "</value>"
+		xmlData += "<value>" + EscapeText(price["value"]) + "</value>"
 		xmlData += "<currency>" + price["currency"] + "</currency>"
 		xmlData += "</price>"
 
@@ -115,36 +212,41 @@ func ConvertJSONToRosetta(fullData map[string]interface{}, w http.ResponseWriter
 		xmlData += "<location>"
 		xmlData += "<lat>" + location["lat"] + "</lat>"
 		xmlData += "<lon>" + location["lon"] + "</lon>"
-		xmlData += "<exact>" + location["exact"] + "</exact>"
+		xmlData += "<exact>" + EscapeText(location["exact"]) + "</exact>"
 		xmlData += "</location>"
 
 		if imagesInterface, ok := advert["Images"].([]interface{}); ok {
-			imageURLs := MapImages(imagesInterface)
+			imageURLs := MapImages(imagesInterface, StringField(advert, "ExternalID"), conversionReport)
+			if options.ImageClient != nil && len(imageURLs) > 0 {
+				imageURLs = CheckImages(imageURLs, options.ImageClient, StringField(advert, "ExternalID"), conversionReport)
+			}
+			if options.Mirror != nil && !options.DryRun && len(imageURLs) > 0 {
+				imageURLs = MirrorImages(imageURLs, options.Mirror, StringField(advert, "ExternalID"), logger, conversionReport)
+			}
 			// Create <images> element
 			if len(imageURLs) > 0 {
 				xmlData += "<images>"
 				for _, imageURL := range imageURLs {
-					xmlData += "<image><url><![CDATA[" + imageURL + "]]></url></image>"
+					xmlData += "<image><url>" + CDATA(imageURL) + "</url></image>"
 				}
 				xmlData += "</images>"
 			}
 		}
 
-		// Check if MovieURL exists:
-		if movie, exists := advert["MovieURL"].(string); exists && movie != "" {
-			// Create <movie> element to XML with CDATA
-			xmlData += "<movie><![CDATA[" + movie + "]]></movie>"
+		// Check if MovieURL exists: a video goes on <movie>, a 3D tour on VirtualTourElement
+		if movie := strings.TrimSpace(StringField(advert, "MovieURL")); movie != "" {
+			xmlData += MapMedia(movie, StringField(advert, "ExternalID"), conversionReport)
 		}
 
 		// Check if NumOfUserLicence exists:
-		if numOfLicence, exists := advert["NumOfUserLicence"].(string); exists && numOfLicence != "" && numOfLicence != "Isento" {
+		if numOfLicence, exists := advert["NumOfUserLicence"].(string); exists && numOfLicence != "" && !validation.IsExemptLicence(numOfLicence) {
 			// Create <number_of_user_license> element to XML with CDATA
-			xmlData += "<number_of_user_license><![CDATA[" + numOfLicence + "]]></number_of_user_license>"
+			xmlData += "<number_of_user_license>" + CDATA(numOfLicence) + "</number_of_user_license>"
 		}
 
 		// Create <market> element to XML with CDATA
 		if market, exists := advert["Market"].(string); exists && market != "" {
-			xmlData += "<market><![CDATA[" + market + "]]></market>"
+			xmlData += "<market>" + CDATA(market) + "</market>"
 		} else {
 			xmlData += "<market>secondary</market>"
 		}
@@ -155,24 +257,39 @@ func ConvertJSONToRosetta(fullData map[string]interface{}, w http.ResponseWriter
 		// Check if ReferenceID exists:
 		/*if referenceId, exists := advert["ReferenceID"].(string); exists && referenceId != "" {
 			// Create <reference_id> element to XML with CDATA
-			xmlData += "<reference_id><![CDATA[" + referenceId + "]]></reference_id>"
+			xmlData += "<reference_id>" + CDATA(referenceId) + "</reference_id>"
 		}
 
 		// Check if ExternalID exists:
 		if externalId, exists := advert["ExternalID"].(string); exists && externalId != "" {
 			// Create <external_id> element to XML with CDATA
-			xmlData += "<external_id><![CDATA[" + externalId + "]]></external_id>"
+			xmlData += "<external_id>" + CDATA(externalId) + "</external_id>"
 		}*/
 
-		externalId := advert["ExternalID"].(string)
-		xmlData += "<external_id><![CDATA[" + externalId + "]]></external_id>"
-		referenceId := advert["ReferenceID"].(string)
-		xmlData += "<reference_id><![CDATA[" + referenceId + "]]></reference_id>"
+		externalId := StringField(advert, "ExternalID")
+		xmlData += "<external_id>" + CDATA(externalId) + "</external_id>"
+		referenceId := StringField(advert, "ReferenceID")
+		xmlData += "<reference_id>" + CDATA(referenceId) + "</reference_id>"
+
+		// Energy certificate number, when the agency sends one along with the class
+		if rawCertificate := FindAttributeValue(advert, CERTIFICATE_OLD); rawCertificate != "" {
+			certificate := NormalizeCertificate(rawCertificate)
+			if certificate.Number != "" {
+				xmlData += "<energy_certificate_number>" + CDATA(certificate.Number) + "</energy_certificate_number>"
+			}
+			switch certificate.Status {
+			case CERTIFICATE_STATUS_IN_PROGRESS:
+				conversionReport.Add(report.Issue{Level: report.LEVEL_INFO, Code: ISSUE_ENERGY_CERTIFICATE_IN_PROGRESS, Message: "Energy certificate not issued yet, nothing published", Field: "certificado_energetico", Value: rawCertificate, ExternalID: externalId})
+			case CERTIFICATE_STATUS_UNKNOWN:
+				conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_UNKNOWN_ENERGY_CERTIFICATE, Message: "Energy certificate class not recognized", Field: "certificado_energetico", Value: rawCertificate, ExternalID: externalId})
+			}
+		}
 
 		xmlData += "</custom_fields>"
 
 		// Convert attributes
-		prepareAttributes := DefineAllAttributesToArray(advert, " | ExternalID: "+externalId+" | ReferenceId: "+referenceId+" | OwnerEmail: "+ownerEmail+" | ")
+		advertLogger := logger.With("owner", ownerEmail, "external_id", externalId, "reference_id", referenceId)
+		prepareAttributes := DefineAllAttributesToArray(advert, advertLogger, conversionReport)
 
 		// Create <attributes> element
 		if len(prepareAttributes) > 0 {
@@ -183,26 +300,56 @@ func ConvertJSONToRosetta(fullData map[string]interface{}, w http.ResponseWriter
 		}
 
 		xmlData += "</advert>"
+
+		// Keep the first adverts so the agency sees what would be published
+		if options.DryRun && conversionReport != nil && len(conversionReport.Preview) < options.PreviewAdverts {
+			advertXML := xmlData[advertStart:]
+			if options.Pretty {
+				advertXML = PrettyPrintXML(advertXML)
+			}
+			conversionReport.AddPreview(advertXML)
+		}
 	}
 
 	xmlData += "</adverts>"
 
 	xmlData += "</data>"
 
+	// Checksum of the canonical (compact) output
+	if conversionReport != nil {
+		conversionReport.OutputSHA256 = CanonicalSHA256(xmlData)
+	}
+
+	if options.Pretty {
+		return PrettyPrintXML(xmlData), nil
+	}
 	return xmlData, nil
 }
 
 //-------------------------------------------------------------------- Add attributes to XML
 
+// AddAllAttributesToXml writes the attributes sorted by URN, multi values sorted and without duplicates, so the output is reproducible
 func AddAllAttributesToXml(dataAttributes map[string]interface{}) string {
+	urns := make([]string, 0, len(dataAttributes))
+	for urn := range dataAttributes {
+		urns = append(urns, urn)
+	}
+	sort.Strings(urns)
+
 	xmlData := ""
-	for urn, value := range dataAttributes {
+	for _, urn := range urns {
+		value := dataAttributes[urn]
 		if values, isSlice := value.([]string); isSlice {
-			for _, val := range values {
-				xmlData += fmt.Sprintf("<attribute><urn>%s</urn><value>%s</value></attribute>", urn, val)
+			sorted := append([]string(nil), values...)
+			sort.Strings(sorted)
+			for i, val := range sorted {
+				if i > 0 && val == sorted[i-1] {
+					continue
+				}
+				xmlData += fmt.Sprintf("<attribute><urn>%s</urn><value>%s</value></attribute>", EscapeText(urn), EscapeText(val))
 			}
 		} else {
-			xmlData += fmt.Sprintf("<attribute><urn>%s</urn><value>%v</value></attribute>", urn, value)
+			xmlData += fmt.Sprintf("<attribute><urn>%s</urn><value>%s</value></attribute>", EscapeText(urn), EscapeText(fmt.Sprint(value)))
 		}
 	}
 	return xmlData
@@ -210,15 +357,34 @@ func AddAllAttributesToXml(dataAttributes map[string]interface{}) string {
 
 //-------------------------------------------------------------------- Prepare attributes
 
-func DefineAllAttributesToArray(adData map[string]interface{}, extra string) map[string]interface{} {
+func DefineAllAttributesToArray(adData map[string]interface{}, logger *slog.Logger, conversionReport *report.Report) map[string]interface{} {
 
 	dataAttributes := make(map[string]interface{})
 
-	// Define area attribute
+	// Define area attribute, routed by the explicit area type or the category
 	if area, exists := adData["Area"]; exists {
 		if areaStr, ok := area.(string); ok {
 			if areaStr != "" {
-				dataAttributes[GROSS_AREA_URN] = areaStr
+				category, _ := adData["Category"].(string)
+				target := AreaTargetURN(category, FindAttributeValue(adData, AREA_TYPE_OLD))
+				if m2, parsed := ParseArea(areaStr); parsed {
+					dataAttributes[target] = FormatArea(m2)
+				} else {
+					logger.Warn("area not possible to parse", logging.Mapping(), "type_urn", target, "value", areaStr)
+				}
+			}
+		}
+	}
+
+	// Define ground area attribute
+	if areaGround, exists := adData["AreaGround"]; exists {
+		if areaGroundStr, ok := areaGround.(string); ok {
+			if areaGroundStr != "" {
+				if m2, parsed := ParseArea(areaGroundStr); parsed {
+					dataAttributes[TERRAIN_AREA_URN] = FormatArea(m2)
+				} else {
+					logger.Warn("area not possible to parse", logging.Mapping(), "type_urn", TERRAIN_AREA_URN, "value", areaGroundStr)
+				}
 			}
 		}
 	}
@@ -250,74 +416,77 @@ func DefineAllAttributesToArray(adData map[string]interface{}, extra string) map
 					attrName, nameExists := attribute["Name"].(string)
 					attrValue, valueExists := attribute["Value"].(string)
 					if nameExists && valueExists {
-						characteristicTypes := getCharacteristicAttributesList()
-						if mapping, exists := characteristicTypes[SanitizeString(attrName)]; exists {
-							switch mapping {
-							// Cases with direct input from client to value
-							case CONSTRUCTION_YEAR_URN, GROSS_AREA_URN:
-								if attrValue != "" {
-									dataAttributes[mapping] = attrValue
-								}
-								break
-							// Special case with specific conversion
-							case CERTIFICATE_URN:
-								conversion := ConvertCertificate(SanitizeString(attrValue))
-								if conversion != "" {
-									dataAttributes[mapping] = conversion
-								}
-								break
-							// Special case with specific conversion as value and the url is named as 'urn:concept:characteristics'
-							case CHARACTERISTICS_URN, STATE_URN, BATHROOM_NUM_URN:
-
-								// Hammer to avoid duplicated value that actually exists on genesis
-								if mapping == BATHROOM_NUM_URN && attrValue == "1" {
-									attrValue = attrValue + "_bath"
-								}
+						definition, exists := LookupAttribute(SanitizeString(attrName))
+						if !exists {
+							// Not in the registry: nothing to map it to
+							logger.Debug("attribute not in registry", logging.Mapping(), "name", attrName, "value", attrValue)
+							continue
+						}
 
-								conversion := Convert(SanitizeString(attrValue), true)
-								if conversion != "" {
-									if charValues, ok := dataAttributes[mapping].([]string); ok {
-										// If there is a slice, append the new conversion
-										dataAttributes[mapping] = append(charValues, conversion)
-									} else {
-										// If it doesn't exist, create a new slice with the conversion
-										dataAttributes[mapping] = []string{conversion}
-									}
-								} else {
-									logToFile("Attribute value: '"+attrValue+"' not possible to map for attr type '"+mapping+"'.", extra)
-								}
-								break
-							// Default
-							default:
-								logToFile("Attr '"+attrName+"' and/or val '"+attrValue+"' not possible to map.", extra)
-								if attrValue != "" {
-									conversion := Convert(SanitizeString(attrValue), true)
-									if conversion != "" {
-										dataAttributes[mapping] = conversion
-									}
+						mapping := definition.URN
+						conversion, converted := definition.Convert(attrValue)
+						if !converted {
+							if attrValue != "" {
+								// Dry runs are left out of the metrics, the published conversion counts the same values
+								if conversionReport == nil || !conversionReport.DryRun {
+									metrics.UnmappedAttributes.Inc(mapping)
 								}
+								logger.Warn("attribute value not possible to map", logging.Mapping(), "type_urn", mapping, "value", attrValue)
+								conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_UNMAPPED_ATTRIBUTE, Message: "Attribute value has no Rosetta equivalent", Field: attrName, Value: attrValue, ExternalID: StringField(adData, "ExternalID")})
 							}
+							continue
+						}
+
+						if definition.IsMulti() && len(conversion) > 0 {
+							// Accumulate on the slice of the URN ('urn:concept:characteristics'...)
+							charValues, _ := dataAttributes[mapping].([]string)
+							dataAttributes[mapping] = append(charValues, conversion...)
+						} else if len(conversion) > 0 {
+							dataAttributes[mapping] = conversion[0]
 						}
 					} else {
 						// Handle cases where "Name" or "Value" is missing
-						fmt.Println("Attribute missing Name or Value")
+						logger.Warn("attribute missing Name or Value")
 					}
 				} else {
 					// Handle cases where the attribute is not a map
-					fmt.Println("Attribute is not a map[string]interface{}")
+					logger.Warn("attribute is not a map[string]interface{}")
 				}
 			}
 		} else {
 			// Handle cases where "Attributes" is not a slice
-			fmt.Println("Attributes is not a []interface{}")
+			logger.Warn("attributes is not a []interface{}")
 		}
 	} else {
 		// Here "Attributes" key are missing
-		fmt.Println("Attributes key not found in advert")
+		logger.Debug("attributes key not found in advert")
 	}
 	return dataAttributes
 }
 
+// FindAttributeValue returns the value of the first <attribute> whose sanitized name matches
+func FindAttributeValue(adData map[string]interface{}, name string) string {
+	attributesSlice, _ := adData["Attributes"].([]interface{})
+	for _, attr := range attributesSlice {
+		attribute, isMap := attr.(map[string]interface{})
+		if !isMap {
+			continue
+		}
+		attrName, _ := attribute["Name"].(string)
+		if SanitizeString(attrName) == name {
+			attrValue, _ := attribute["Value"].(string)
+			return attrValue
+		}
+	}
+	return ""
+}
+
+// StringField reads a string field of a decoded JSON object, "" when it is missing or of another type
+func StringField(data map[string]interface{}, key string) string {
+	value, _ := data[key].(string)
+	return value
+}
+
 //------------------------------------------------------------ Typology
 
 func MapSize(size interface{}) string {
@@ -345,20 +514,6 @@ func MapSize(size interface{}) string {
 	return typology[lowerSize]
 }
 
-//------------------------------------------------------------ Images
-
-func MapImages(imagesSlice []interface{}) []string {
-	var imageList []string
-
-	for _, image := range imagesSlice {
-		if imageURL, ok := image.(string); ok {
-			imageList = append(imageList, imageURL)
-		}
-	}
-
-	return imageList
-}
-
 //------------------------------------------------------------- Price
 
 func MapLocation(advert map[string]interface{}) map[string]string {
@@ -381,6 +536,12 @@ func MapLocation(advert map[string]interface{}) map[string]string {
 
 //------------------------------------------------------------- Price
 
+// ValidPrice tells if the price is a positive number ("250000", "1.250,50"...)
+func ValidPrice(price string) bool {
+	value, parsed := parseDecimal(strings.TrimSpace(price))
+	return parsed && value > 0
+}
+
 func MapPrice(price string) map[string]string {
 	priceData := make(map[string]string)
 
@@ -390,29 +551,44 @@ func MapPrice(price string) map[string]string {
 	return priceData
 }
 
-//-------------------------------------------------------------- Consultant
+//-------------------------------------------------------------- Agency
 
-func MapConsulterContact(consultantEmail string, fullData map[string]interface{}) map[string]string {
-	consultantData := make(map[string]string)
+// agencyFields is the order of the elements inside <agency>
+var agencyFields = []string{"company_name", "contact_name", "phone", "address", "postal_code", "ami", "tax_id"}
 
-	if consultantsData, ok := fullData["Consultants"].([]interface{}); ok {
-		// Iterate consultant list
-		for _, data := range consultantsData {
-			consultant := data.(map[string]interface{})
-			email := consultant["Email"].(string)
+// MapAgency gets the agency profile from the "User" block so Rosetta can create or update the account
+func MapAgency(fullData map[string]interface{}) map[string]string {
+	agencyData := make(map[string]string)
 
-			if email == consultantEmail {
-				// Found person
-				consultantData["email"] = email
-				consultantData["name"] = consultant["Name"].(string)
-				consultantData["phone"] = consultant["Phone"].(string)
-				consultantData["photo"] = consultant["Photo"].(string)
-				break
-			}
+	userMap, userExists := fullData["User"].(map[string]interface{})
+	if !userExists {
+		return agencyData
+	}
+
+	// Helper to read a trimmed string field
+	field := func(key string) string {
+		value, _ := userMap[key].(string)
+		return strings.TrimSpace(value)
+	}
+
+	contactName := strings.TrimSpace(field("FirstName") + " " + field("LastName"))
+
+	values := map[string]string{
+		"company_name": field("CompanyName"),
+		"contact_name": contactName,
+		"phone":        field("Phone"),
+		"address":      field("Address"),
+		"postal_code":  field("PostalCode"),
+		"ami":          field("Ami"),
+		"tax_id":       field("TaxID"),
+	}
+	for key, value := range values {
+		if value != "" {
+			agencyData[key] = value
 		}
 	}
 
-	return consultantData
+	return agencyData
 }
 
 //-------------------------------------------------------------- Owner
@@ -422,13 +598,13 @@ func ConvertOwnerEmail(fullData map[string]interface{}) string {
 	// Access the "User" key inside fullData
 	userMap, userExists := fullData["User"].(map[string]interface{})
 	if !userExists {
-		fmt.Println("Key 'User' not found or is not a map")
+		slog.Warn("key 'User' not found or is not a map")
 	}
 
 	// Access the "Email" field inside the "User" map.
 	userEmail, emailExists := userMap["Email"].(string)
 	if !emailExists || len(userEmail) == 0 {
-		fmt.Println("Key 'Email' not found or is not a string or is empty")
+		slog.Debug("key 'Email' not found or is not a string or is empty")
 	} else {
 		// Case exist exit
 		return userEmail
@@ -437,24 +613,26 @@ func ConvertOwnerEmail(fullData map[string]interface{}) string {
 	// Check if the "Adverts" key exists and is an array of maps
 	adverts, advertsExists := fullData["Adverts"].([]interface{})
 	if !advertsExists {
-		fmt.Println("Key 'Adverts' not found or is not an array")
+		slog.Warn("key 'Adverts' not found or is not an array")
 	}
 
 	// Check if there is at least one element in the "Adverts" array
 	if len(adverts) == 0 {
-		fmt.Println("Array 'Adverts' is empty")
+		slog.Warn("array 'Adverts' is empty")
+		return ""
 	}
 
 	// Access the first element of the "Adverts" array
 	firstAdvert, isFirstAdvertMap := adverts[0].(map[string]interface{})
 	if !isFirstAdvertMap {
-		fmt.Println("First element of 'Adverts' is not a map")
+		slog.Warn("first element of 'Adverts' is not a map")
+		return ""
 	}
 
 	// Check if the "Email" key exists in the first element of "Adverts"
 	email, emailExists := firstAdvert["Email"].(string)
 	if !emailExists {
-		fmt.Println("Key 'Email' not found or is not a string")
+		slog.Warn("key 'Email' not found or is not a string")
 	}
 
 	return email
@@ -463,12 +641,20 @@ func ConvertOwnerEmail(fullData map[string]interface{}) string {
 //------------------------------------------------------------------- Categories
 
 func MapCategoryURN(offerType, category string) string {
-	offerType = SanitizeString(offerType)
+	offerType, known := NormalizeOfferType(offerType)
+	if !known {
+		return ""
+	}
 	category = SanitizeString(category)
 	categoryMap := GetCategoryList()
 
+	// A business transfer is always the goodwill category, whatever the feed says
+	if offerType == OFFER_TYPE_TRANSFER {
+		return categoryMap[OFFER_TYPE_SALE]["trespasse"]
+	}
+
 	if category == "" {
-		if offerType == "venda" {
+		if offerType == OFFER_TYPE_SALE {
 			return "urn:concept:realestate-for-sale"
 		}
 		return "urn:concept:realestate-for-rent"
@@ -482,37 +668,13 @@ func MapCategoryURN(offerType, category string) string {
 
 //------------------------------------------------------------------- Helpers
 
-// ConvertCertificate gets the certificate mapping
+// ConvertCertificate gets the certificate URN ("urn:concept:b-minus", "urn:concept:exempt"...)
 func ConvertCertificate(certificate string) string {
-	// If certificate is not a valid string, return nil
-	if certificate == "" {
+	class := NormalizeCertificate(certificate).Class
+	if class == "" {
 		return ""
 	}
-
-	// Convert to lowercase for comparison
-	lowerCertificate := strings.ToLower(certificate)
-
-	// Map 'b-' to 'bminus' and 'a-' to 'aplus'
-	if lowerCertificate == "b-" {
-		return "bminus"
-	} else if lowerCertificate == "a-" {
-		return "aplus"
-	}
-
-	// If not 'b-' or 'a-', perform the conversion using the convert() function
-	// Assuming convert() is a function that handles the other cases
-	return Convert(certificate, true)
-}
-
-func getCharacteristicAttributesList() map[string]string {
-	return map[string]string{
-		CHARACTERISTICS_OLD:   CHARACTERISTICS_URN,
-		STATE_OLD:             STATE_URN,
-		CONSTRUCTION_YEAR_OLD: CONSTRUCTION_YEAR_URN,
-		BATHROOM_NUM_OLD:      BATHROOM_NUM_URN,
-		GROSS_AREA_OLD:        GROSS_AREA_URN,
-		CERTIFICATE_OLD:       CERTIFICATE_URN,
-	}
+	return Convert(class, true)
 }
 
 func Convert(param string, invert bool) string {
@@ -616,31 +778,3 @@ func RemoveAccent(str string) string {
 	result, _, _ := transform.String(t, str)
 	return result
 }
-
-func logToFile(message string, extra string) {
-	file, err := os.OpenFile("notes_marta.log", os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer file.Close()
-
-	content, err := os.ReadFile("notes_marta.log")
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	if strings.Contains(string(content), message) {
-		return
-	}
-
-	_, err = file.Seek(0, 2)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	log.SetOutput(file)
-	log.Println(extra + message)
-}
@@ -0,0 +1,165 @@
+package convert_to_rosetta
+
+import (
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzSanitizeString(f *testing.F) {
+	for _, seed := range []string{"Casas de banho", "Área bruta (m²)", "garagem-box", "Porta Blindada/Segurança", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		sanitized := SanitizeString(value)
+		if strings.ContainsAny(sanitized, " /-") {
+			t.Fatalf("SanitizeString(%q) = %q still has spaces, slashes or dashes", value, sanitized)
+		}
+		if again := SanitizeString(sanitized); again != sanitized {
+			t.Fatalf("SanitizeString is not idempotent: %q -> %q -> %q", value, sanitized, again)
+		}
+	})
+}
+
+func FuzzMapSize(f *testing.F) {
+	for _, seed := range []string{"T3", "t0", "T10", "zero", "mais", ""} {
+		f.Add(seed)
+	}
+
+	typology := GetTypologyList()
+	f.Fuzz(func(t *testing.T, size string) {
+		mapped := MapSize(size)
+		if mapped == "more" {
+			return
+		}
+		found := false
+		for _, value := range typology {
+			if value == mapped {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("MapSize(%q) = %q is not a typology value", size, mapped)
+		}
+	})
+}
+
+func FuzzMapCategoryURN(f *testing.F) {
+	f.Add("Venda", "Moradias")
+	f.Add("Arrendamento", "Apartamentos para férias")
+	f.Add("", "")
+	f.Add("Rent", "Lojas")
+
+	f.Fuzz(func(t *testing.T, offerType string, category string) {
+		urn := MapCategoryURN(offerType, category)
+		if urn != "" && !strings.HasPrefix(urn, "urn:concept:") {
+			t.Fatalf("MapCategoryURN(%q, %q) = %q is not a concept URN", offerType, category, urn)
+		}
+	})
+}
+
+func FuzzConvertCertificate(f *testing.F) {
+	for _, seed := range []string{"A+", "B-", "Isento", "Em curso", "Não aplicável", "NC", "B - SCE0000123456789", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, certificate string) {
+		urn := ConvertCertificate(certificate)
+		if urn != "" && !strings.HasPrefix(urn, "urn:concept:") {
+			t.Fatalf("ConvertCertificate(%q) = %q is not a concept URN", certificate, urn)
+		}
+
+		normalized := NormalizeCertificate(certificate)
+		if normalized.Status == CERTIFICATE_STATUS_CLASS && normalized.Class == "" {
+			t.Fatalf("NormalizeCertificate(%q) has a class status without class", certificate)
+		}
+	})
+}
+
+func FuzzDefineAllAttributesToArray(f *testing.F) {
+	f.Add("Caracteristicas", "garagem-box", "1.200 m2", "T3", "Terrenos")
+	f.Add("Casas de banho", "-1", "", "", "")
+	f.Add("Certificado Energético", "B-", "2 ha", "T0", "Quintas e herdades")
+	f.Add("Elevador", "Sim", "abc", "mais", "Moradias")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	f.Fuzz(func(t *testing.T, name string, value string, area string, size string, category string) {
+		advert := map[string]interface{}{
+			"Area":     area,
+			"Size":     size,
+			"Category": category,
+			"Attributes": []interface{}{
+				map[string]interface{}{"Name": name, "Value": value},
+			},
+		}
+
+		attributes := DefineAllAttributesToArray(advert, logger, nil)
+		for urn, converted := range attributes {
+			if !strings.HasPrefix(urn, "urn:concept:") {
+				t.Fatalf("attribute URN %q is not a concept URN", urn)
+			}
+			switch converted.(type) {
+			case string, []string:
+			default:
+				t.Fatalf("attribute %q has a value of type %T", urn, converted)
+			}
+		}
+
+		// Whatever came in, the XML must stay well formed: the decoder must reach the end without an error
+		xmlData := AddAllAttributesToXml(attributes)
+		decoder := xml.NewDecoder(strings.NewReader("<attributes>" + xmlData + "</attributes>"))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("attributes are not well formed XML (%v): %s", err, xmlData)
+			}
+		}
+	})
+}
+
+func FuzzNormalizeImageURL(f *testing.F) {
+	for _, seed := range []string{"https://cdn.example.pt/1.jpg", "http://CDN.example.pt:80/a b.jpg", "//cdn.example.pt/1.jpg?utm_source=x#y", "javascript:alert(1)", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		normalized, valid := NormalizeImageURL(raw)
+		if !valid {
+			return
+		}
+		if !strings.HasPrefix(normalized, "https://") && !strings.HasPrefix(normalized, "http://") {
+			t.Fatalf("NormalizeImageURL(%q) = %q is not a web address", raw, normalized)
+		}
+		if again, _ := NormalizeImageURL(normalized); again != normalized {
+			t.Fatalf("NormalizeImageURL is not idempotent: %q -> %q -> %q", raw, normalized, again)
+		}
+	})
+}
+
+func FuzzCleanDescription(f *testing.F) {
+	for _, seed := range []string{"<p>Sala <b>ampla</b></p>", "&lt;p&gt;T2&lt;/p&gt;", "<b><i>aberto", "Ligue 912 345 678", "<script>x()</script>Texto", ""} {
+		f.Add(seed, 40)
+	}
+
+	defer func(rules TextRules) { Text = rules }(Text)
+	f.Fuzz(func(t *testing.T, raw string, maxLength int) {
+		Text.MaxDescriptionLength = (maxLength%200+200)%200 + 1
+		cleaned, _ := CleanDescription(raw)
+		if !utf8.ValidString(cleaned) && utf8.ValidString(raw) {
+			t.Fatalf("CleanDescription(%q) = %q is not valid UTF-8", raw, cleaned)
+		}
+		if length := visibleLength(cleaned, true); length > Text.MaxDescriptionLength {
+			t.Fatalf("CleanDescription(%q) = %q has %d characters, limit %d", raw, cleaned, length, Text.MaxDescriptionLength)
+		}
+		if strings.Contains(strings.ToLower(cleaned), "<script") {
+			t.Fatalf("CleanDescription(%q) = %q keeps a script", raw, cleaned)
+		}
+	})
+}
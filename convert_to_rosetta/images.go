@@ -0,0 +1,257 @@
+package convert_to_rosetta
+
+import (
+	"errors"
+	"fmt"
+	"go-test/mirror"
+	"go-test/report"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxImages is the number of images kept per advert, Rosetta truncates longer galleries anyway
+var MaxImages = 50
+
+// Parallel HEAD requests of one advert
+const IMAGE_CHECK_CONCURRENCY = 8
+
+// Query parameters that only track the click and make the same image look like another one
+var trackingParameters = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "fbclid", "gclid", "mc_cid", "mc_eid", "_ga"}
+
+// HTTPClient sends the image checks; *http.Client does, tests plug a stub server client
+type HTTPClient interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// sourceImage is one <image> of the feed with its optional order and main attributes
+type sourceImage struct {
+	url      string
+	order    int
+	hasOrder bool
+	main     bool
+	position int // position on the feed, keeps the sort stable
+}
+
+// MapImages normalizes the image URLs of an advert, leaves out the invalid ones and the duplicates,
+// puts the main image first and the rest on the feed order and keeps up to MaxImages
+func MapImages(imagesSlice []interface{}, externalID string, conversionReport *report.Report) []string {
+	var images []sourceImage
+	seen := map[string]int{} // URL without the scheme -> index on images
+	duplicates := 0
+
+	for position, image := range imagesSlice {
+		source, isImage := readSourceImage(image)
+		if !isImage {
+			continue
+		}
+		normalized, valid := NormalizeImageURL(source.url)
+		if !valid {
+			conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_INVALID_IMAGE_URL, Message: "Image URL is empty or not a web address, left out", Field: "image", Value: source.url, ExternalID: externalID})
+			continue
+		}
+		// http and https of the same image are one, the https one wins
+		key := strings.TrimPrefix(strings.TrimPrefix(normalized, "https:"), "http:")
+		if index, exists := seen[key]; exists {
+			if strings.HasPrefix(normalized, "https:") {
+				images[index].url = normalized
+			}
+			duplicates++
+			continue
+		}
+		seen[key] = len(images)
+		source.url = normalized
+		source.position = position
+		images = append(images, source)
+	}
+
+	if duplicates > 0 {
+		conversionReport.Add(report.Issue{Level: report.LEVEL_INFO, Code: ISSUE_DUPLICATE_IMAGE, Message: fmt.Sprintf("%d duplicated image(s) left out", duplicates), Field: "image", ExternalID: externalID})
+	}
+
+	// Main image first, then the explicit order, then the rest as they come on the feed
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].main != images[j].main {
+			return images[i].main
+		}
+		if images[i].hasOrder != images[j].hasOrder {
+			return images[i].hasOrder
+		}
+		if images[i].hasOrder && images[i].order != images[j].order {
+			return images[i].order < images[j].order
+		}
+		return images[i].position < images[j].position
+	})
+
+	if MaxImages > 0 && len(images) > MaxImages {
+		conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_TOO_MANY_IMAGES, Message: fmt.Sprintf("%d images, only the first %d are kept", len(images), MaxImages), Field: "image", Value: strconv.Itoa(len(images)), ExternalID: externalID})
+		images = images[:MaxImages]
+	}
+
+	imageList := make([]string, 0, len(images))
+	for _, image := range images {
+		imageList = append(imageList, image.url)
+	}
+	return imageList
+}
+
+// NormalizeImageURL lowercases the scheme and the host and drops the default port, the fragment and the tracking parameters.
+// http stays http: many agency hosts have no TLS, CheckImages upgrades the ones that answer on https.
+func NormalizeImageURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.ContainsAny(raw, " \t\r\n") {
+		return "", false
+	}
+	if strings.HasPrefix(raw, "//") {
+		raw = "https:" + raw
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || parsed.User != nil {
+		return "", false
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", false
+	}
+
+	// The default port of the scheme says nothing
+	parsed.Host = strings.ToLower(parsed.Host)
+	if port := parsed.Port(); (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		parsed.Host = parsed.Hostname()
+	}
+	if parsed.Hostname() == "" {
+		return "", false
+	}
+	parsed.Fragment = ""
+
+	// Re-encoded only when something goes, signed CDN URLs break on any other change
+	if parsed.RawQuery != "" {
+		query := parsed.Query()
+		tracked := false
+		for _, parameter := range trackingParameters {
+			tracked = tracked || query.Has(parameter)
+			query.Del(parameter)
+		}
+		if tracked {
+			parsed.RawQuery = query.Encode()
+		}
+	}
+	return parsed.String(), true
+}
+
+// CheckImages sends a HEAD request for every image and leaves out the ones that do not answer with an image;
+// http images that answer with an image on https too are upgraded
+func CheckImages(imageURLs []string, client HTTPClient, externalID string, conversionReport *report.Report) []string {
+	problems := make([]string, len(imageURLs))
+	checkedURLs := append([]string(nil), imageURLs...)
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, IMAGE_CHECK_CONCURRENCY)
+	for i, imageURL := range imageURLs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, imageURL string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if strings.HasPrefix(imageURL, "http:") {
+				secureURL := "https:" + strings.TrimPrefix(imageURL, "http:")
+				if _, verified := checkImage(client, secureURL); verified {
+					checkedURLs[i] = secureURL
+					return
+				}
+			}
+			problems[i], _ = checkImage(client, imageURL)
+		}(i, imageURL)
+	}
+	wg.Wait()
+
+	working := make([]string, 0, len(imageURLs))
+	for i, imageURL := range checkedURLs {
+		if problems[i] != "" {
+			conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_BROKEN_IMAGE, Message: "Image is not reachable (" + problems[i] + "), left out", Field: "image", Value: imageURL, ExternalID: externalID})
+			continue
+		}
+		working = append(working, imageURL)
+	}
+	return working
+}
+
+// MirrorImages swaps the URLs for our copies; an image we could not copy keeps its URL, one that is not an image goes
+func MirrorImages(imageURLs []string, imageMirror *mirror.Mirror, externalID string, logger *slog.Logger, conversionReport *report.Report) []string {
+	results, err := imageMirror.MirrorAll(imageURLs)
+	if err != nil {
+		logger.Warn("error saving the image mirror cache", "error", err)
+	}
+
+	mirrored := make([]string, 0, len(results))
+	for _, result := range results {
+		switch {
+		case errors.Is(result.Err, mirror.ErrNotImage):
+			conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_NOT_AN_IMAGE, Message: "URL does not serve a JPEG, PNG, GIF or WebP image (" + result.Err.Error() + "), left out", Field: "image", Value: result.Source, ExternalID: externalID})
+			continue
+		case result.Err != nil:
+			conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_MIRROR_FAILED, Message: "Image could not be copied (" + result.Err.Error() + "), the original URL is kept", Field: "image", Value: result.Source, ExternalID: externalID})
+		}
+		mirrored = append(mirrored, result.URL)
+	}
+	return mirrored
+}
+
+//-------------------------------------------------------------------- Helpers
+
+// readSourceImage takes a plain URL or the {URL, Order, Main} of convert_to_json
+func readSourceImage(image interface{}) (sourceImage, bool) {
+	switch value := image.(type) {
+	case string:
+		return sourceImage{url: value}, true
+	case map[string]interface{}:
+		source := sourceImage{url: StringField(value, "URL")}
+		if order, err := strconv.Atoi(strings.TrimSpace(StringField(value, "Order"))); err == nil {
+			source.order = order
+			source.hasOrder = true
+		}
+		switch strings.ToLower(strings.TrimSpace(StringField(value, "Main"))) {
+		case "true", "1", "yes", "sim":
+			source.main = true
+		}
+		return source, true
+	}
+	return sourceImage{}, false
+}
+
+// checkImage returns why the image is broken, "" when it is fine or the server does not tell;
+// verified is true only when the server did answer with an image
+func checkImage(client HTTPClient, imageURL string) (string, bool) {
+	request, err := http.NewRequest(http.MethodHead, imageURL, nil)
+	if err != nil {
+		return err.Error(), false
+	}
+	response, err := client.Do(request)
+	if errors.Is(err, mirror.ErrBlockedAddress) {
+		return "not a public address", false
+	}
+	if err != nil {
+		// Timeouts and refused connections say nothing about the image, like a busy server
+		return "", false
+	}
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusMethodNotAllowed, response.StatusCode == http.StatusNotImplemented,
+		response.StatusCode == http.StatusTooManyRequests, response.StatusCode == http.StatusServiceUnavailable:
+		// No HEAD support or busy: nothing we can tell, keep it
+		return "", false
+	case response.StatusCode >= 400:
+		return "status " + strconv.Itoa(response.StatusCode), false
+	}
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "" && !strings.HasPrefix(strings.ToLower(contentType), "image/") {
+		return "content type " + contentType, false
+	}
+	return "", response.StatusCode < 300
+}
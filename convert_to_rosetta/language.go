@@ -0,0 +1,266 @@
+package convert_to_rosetta
+
+import (
+	"go-test/report"
+	"sort"
+	"strings"
+)
+
+// Language of the portal: its text goes on the plain <title> and <description>
+const DEFAULT_LANGUAGE = "pt"
+
+// Stopword hits the detected language needs, and how many times those of the runner-up
+const (
+	LANGUAGE_MIN_HITS = 2
+	LANGUAGE_MIN_LEAD = 1.5
+)
+
+// Frequent words of every language we detect, unaccented like normalizeText leaves them
+var languageStopwords = map[string][]string{
+	"pt": {"com", "em", "do", "da", "dos", "das", "no", "na", "nos", "uma", "para", "ao", "nao", "tem", "esta", "muito", "quartos", "cozinha", "sala", "banho", "moradia", "apartamento", "arrecadacao", "garagem", "localizacao", "varanda", "zona"},
+	"en": {"the", "and", "with", "for", "of", "this", "is", "in", "bedroom", "bedrooms", "bathroom", "bathrooms", "kitchen", "living", "room", "sea", "view", "house", "apartment", "located", "property", "garden", "pool"},
+	"es": {"el", "los", "las", "con", "del", "por", "y", "es", "un", "dormitorios", "cocina", "bano", "banos", "piso", "vivienda", "salon", "terraza", "ubicado", "habitaciones", "muy"},
+	"fr": {"le", "les", "des", "avec", "pour", "et", "est", "dans", "du", "chambre", "chambres", "cuisine", "maison", "salle", "bains", "vue", "situe", "sejour", "tres"},
+	"de": {"der", "die", "und", "mit", "fur", "ist", "ein", "eine", "im", "zimmer", "kuche", "bad", "haus", "wohnung", "garten", "blick", "schlafzimmer", "sehr"},
+	"it": {"il", "gli", "di", "della", "delle", "camera", "camere", "cucina", "bagno", "appartamento", "giardino", "situato", "molto", "soggiorno"},
+	"nl": {"het", "een", "en", "met", "voor", "van", "slaapkamer", "slaapkamers", "keuken", "badkamer", "huis", "tuin", "uitzicht", "zeer"},
+}
+
+// Other ways agencies write the languages on lang=""
+var languageAliases = map[string]string{
+	"por": "pt", "portugues": "pt", "portuguese": "pt",
+	"eng": "en", "english": "en", "ingles": "en",
+	"spa": "es", "esp": "es", "espanol": "es", "spanish": "es", "espanhol": "es",
+	"fra": "fr", "fre": "fr", "francais": "fr", "french": "fr", "frances": "fr",
+	"deu": "de", "ger": "de", "deutsch": "de", "german": "de", "alemao": "de",
+	"ita": "it", "italiano": "it", "italian": "it",
+	"nld": "nl", "dut": "nl", "nederlands": "nl", "dutch": "nl", "holandes": "nl",
+}
+
+// LocalizedText is the title and description of an advert in one language
+type LocalizedText struct {
+	Lang        string
+	Title       string
+	Description string
+	Detected    bool // the language came from DetectLanguage, not from the feed
+}
+
+// NormalizeLanguage returns the primary language of "pt-PT", "EN", "english", "ru"...; "" when it is not a language tag.
+// Any well-formed BCP 47 tag is kept, not only the languages we detect.
+func NormalizeLanguage(raw string) string {
+	lang := strings.ToLower(strings.TrimSpace(RemoveAccent(raw)))
+	if alias, exists := languageAliases[lang]; exists {
+		return alias
+	}
+
+	subtags := strings.FieldsFunc(lang, func(r rune) bool { return r == '-' || r == '_' })
+	if len(subtags) == 0 || !isLetters(subtags[0]) || len(subtags[0]) < 2 || len(subtags[0]) > 3 {
+		return ""
+	}
+	for _, subtag := range subtags[1:] {
+		if !isAlphanumeric(subtag) || len(subtag) > 8 {
+			return ""
+		}
+	}
+	if alias, exists := languageAliases[subtags[0]]; exists {
+		return alias
+	}
+	return subtags[0]
+}
+
+// DetectLanguage guesses the language from its frequent words; false when the text says too little
+func DetectLanguage(text string) (string, bool) {
+	words := strings.Fields(normalizeText(text))
+	hits := map[string]int{}
+	for lang, stopwords := range languageStopwords {
+		set := make(map[string]bool, len(stopwords))
+		for _, stopword := range stopwords {
+			set[stopword] = true
+		}
+		for _, word := range words {
+			if set[word] {
+				hits[lang]++
+			}
+		}
+	}
+
+	// Most hits first, ties broken by code so the result is stable
+	langs := make([]string, 0, len(hits))
+	for lang := range hits {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if hits[langs[i]] != hits[langs[j]] {
+			return hits[langs[i]] > hits[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	if len(langs) == 0 || hits[langs[0]] < LANGUAGE_MIN_HITS {
+		return "", false
+	}
+	if len(langs) > 1 && float64(hits[langs[0]]) < LANGUAGE_MIN_LEAD*float64(hits[langs[1]]) {
+		return "", false
+	}
+	return langs[0], true
+}
+
+// AdvertTexts groups the titles and descriptions by language, the Portuguese (or else the first) one first.
+// Untagged texts get the detected language, Portuguese when there is not enough text to tell;
+// tagged ones keep their language, and a lang="" that is not a language tag leaves the text out.
+func AdvertTexts(advert map[string]interface{}, externalID string, conversionReport *report.Report) []LocalizedText {
+	titles := taggedTexts(advert, "Titles", "Title", externalID, conversionReport)
+	descriptions := taggedTexts(advert, "Descriptions", "Description", externalID, conversionReport)
+
+	// An untagged title is too short to tell alone: with a single untagged description they are read together
+	untaggedTitles, untaggedDescriptions := untagged(titles), untagged(descriptions)
+	if len(untaggedTitles) == 1 && len(untaggedDescriptions) == 1 {
+		lang, detected := detectOrDefault(titles[untaggedTitles[0]].text + "\n" + descriptions[untaggedDescriptions[0]].text)
+		titles[untaggedTitles[0]].lang, titles[untaggedTitles[0]].detected = lang, detected
+		descriptions[untaggedDescriptions[0]].lang, descriptions[untaggedDescriptions[0]].detected = lang, detected
+	}
+	for _, texts := range [][]taggedText{titles, descriptions} {
+		for i := range texts {
+			if texts[i].lang == "" {
+				texts[i].lang, texts[i].detected = detectOrDefault(texts[i].text)
+			}
+		}
+	}
+
+	// One entry per language, on the order they first show up; the first text of a language wins
+	var localized []LocalizedText
+	index := map[string]int{}
+	entry := func(lang string) *LocalizedText {
+		if i, exists := index[lang]; exists {
+			return &localized[i]
+		}
+		index[lang] = len(localized)
+		localized = append(localized, LocalizedText{Lang: lang})
+		return &localized[len(localized)-1]
+	}
+	for _, title := range titles {
+		if text := entry(title.lang); text.Title == "" {
+			text.Title = title.text
+			text.Detected = text.Detected || title.detected
+		}
+	}
+	for _, description := range descriptions {
+		if text := entry(description.lang); text.Description == "" {
+			text.Description = description.text
+			text.Detected = text.Detected || description.detected
+		}
+	}
+
+	if i, exists := index[DEFAULT_LANGUAGE]; exists && i > 0 {
+		main := localized[i]
+		copy(localized[1:i+1], localized[:i])
+		localized[0] = main
+	}
+	if len(localized) == 0 {
+		localized = append(localized, LocalizedText{Lang: DEFAULT_LANGUAGE})
+	}
+	return localized
+}
+
+// MapLocalizedText returns the <title> and <description> of one language, cleaned up; lang="" on all but the Portuguese main one
+func MapLocalizedText(text LocalizedText, main bool, externalID string, conversionReport *report.Report) string {
+	langAttribute, field := "", ""
+	if !main || text.Lang != DEFAULT_LANGUAGE {
+		langAttribute = ` lang="` + text.Lang + `"`
+	}
+	if !main {
+		field = "[" + text.Lang + "]"
+	}
+
+	if text.Detected && text.Lang != DEFAULT_LANGUAGE {
+		conversionReport.Add(report.Issue{Level: report.LEVEL_INFO, Code: ISSUE_LANGUAGE_DETECTED, Message: "Title or description without a language, detected as '" + text.Lang + "'", Field: "lang", Value: text.Lang, ExternalID: externalID})
+	}
+	if main && text.Lang != DEFAULT_LANGUAGE {
+		conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_NO_PORTUGUESE_TEXT, Message: "No Portuguese title or description, the '" + text.Lang + "' one is the main text", Field: "lang", Value: text.Lang, ExternalID: externalID})
+	}
+
+	// Get title, as one line of plain text within the portal limit:
+	title, titleChanges := CleanTitle(text.Title)
+	textIssues("title"+field, titleChanges, Text.MaxTitleLength, externalID, conversionReport)
+
+	// Get description, with only the allowlisted HTML (or none) and tidy whitespace
+	description, descriptionChanges := CleanDescription(text.Description)
+	textIssues("description"+field, descriptionChanges, Text.MaxDescriptionLength, externalID, conversionReport)
+
+	// Create <title> and <description> elements to XML with CDATA
+	return "<title" + langAttribute + ">" + CDATA(title) + "</title>" +
+		"<description" + langAttribute + ">" + CDATA(description) + "</description>"
+}
+
+//-------------------------------------------------------------------- Helpers
+
+type taggedText struct {
+	text     string
+	lang     string
+	detected bool
+}
+
+// taggedTexts reads the {Lang, Text} list of convert_to_json, or the single field when there is none.
+// lang is "" only for the untagged texts, the ones to detect.
+func taggedTexts(advert map[string]interface{}, listField string, field string, externalID string, conversionReport *report.Report) []taggedText {
+	var texts []taggedText
+	list, isList := advert[listField].([]interface{})
+	for _, item := range list {
+		value, isMap := item.(map[string]interface{})
+		if !isMap || strings.TrimSpace(StringField(value, "Text")) == "" {
+			continue
+		}
+
+		text := taggedText{text: StringField(value, "Text")}
+		if rawLang := StringField(value, "Lang"); strings.TrimSpace(rawLang) != "" {
+			// Still a tag: detecting it, or the Portuguese default, could put a foreign text in the Portuguese slot
+			text.lang = NormalizeLanguage(rawLang)
+			if text.lang == "" {
+				conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_INVALID_LANGUAGE, Message: "Language of the " + strings.ToLower(field) + " is not a language tag, the text is left out", Field: "lang", Value: rawLang, ExternalID: externalID})
+				continue
+			}
+		}
+		texts = append(texts, text)
+	}
+	if !isList {
+		if text := StringField(advert, field); strings.TrimSpace(text) != "" {
+			texts = append(texts, taggedText{text: text})
+		}
+	}
+	return texts
+}
+
+func untagged(texts []taggedText) []int {
+	var indexes []int
+	for i, text := range texts {
+		if text.lang == "" {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func isLetters(text string) bool {
+	for _, r := range text {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(text string) bool {
+	for _, r := range text {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return text != ""
+}
+
+// detectOrDefault returns the detected language, DEFAULT_LANGUAGE (not flagged as detected) when it cannot tell
+func detectOrDefault(text string) (string, bool) {
+	if lang, detected := DetectLanguage(text); detected {
+		return lang, true
+	}
+	return DEFAULT_LANGUAGE, false
+}
@@ -0,0 +1,129 @@
+package convert_to_rosetta
+
+import (
+	"go-test/report"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text     string
+		lang     string
+		detected bool
+	}{
+		{"Moradia com piscina e garagem, na zona da praia, com três quartos e cozinha equipada.", "pt", true},
+		{"Beautiful villa with sea view, three bedrooms and a private pool in the heart of the Algarve.", "en", true},
+		{"Piso con terraza y vistas al mar, tres dormitorios y cocina equipada, muy luminoso.", "es", true},
+		{"Maison avec jardin et vue sur la mer, trois chambres et une cuisine équipée dans un quartier calme.", "fr", true},
+		{"Schönes Haus mit Garten und Blick auf das Meer, drei Schlafzimmer und eine moderne Küche.", "de", true},
+		{"Appartamento con vista mare, due camere e cucina abitabile, molto luminoso.", "it", true},
+		{"Villa T4", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		lang, detected := DetectLanguage(test.text)
+		if lang != test.lang || detected != test.detected {
+			t.Errorf("DetectLanguage(%q) = %q, %v, want %q, %v", test.text, lang, detected, test.lang, test.detected)
+		}
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		raw  string
+		lang string
+	}{
+		{"pt-PT", "pt"},
+		{" EN ", "en"},
+		{"english", "en"},
+		{"Português", "pt"},
+		{"ru", "ru"},
+		{"sv_SE", "sv"},
+		{"zh-Hant-TW", "zh"},
+		{"ger-DE", "de"},
+		{"", ""},
+		{"x-klingon", ""},
+		{"russo", ""},
+		{"pt-", "pt"},
+		{"r1", ""},
+	}
+
+	for _, test := range tests {
+		if lang := NormalizeLanguage(test.raw); lang != test.lang {
+			t.Errorf("NormalizeLanguage(%q) = %q, want %q", test.raw, lang, test.lang)
+		}
+	}
+}
+
+func TestAdvertTexts(t *testing.T) {
+	advert := map[string]interface{}{
+		"Titles": []interface{}{
+			map[string]interface{}{"Lang": "EN", "Text": "Sea view villa"},
+			map[string]interface{}{"Lang": "", "Text": "Moradia com vista mar"},
+			map[string]interface{}{"Lang": "fr-FR", "Text": "Villa vue mer"},
+		},
+		"Descriptions": []interface{}{
+			map[string]interface{}{"Lang": "english", "Text": "Villa with a pool and a garden."},
+			map[string]interface{}{"Lang": "", "Text": "Moradia com piscina e jardim, na zona da praia."},
+			map[string]interface{}{"Lang": "", "Text": "Wunderschönes Haus mit Garten und Blick auf das Meer."},
+		},
+	}
+
+	texts := AdvertTexts(advert, "a1", report.New())
+	if len(texts) != 4 {
+		t.Fatalf("AdvertTexts = %+v, want pt, en, fr and de", texts)
+	}
+	want := []LocalizedText{
+		{Lang: "pt", Title: "Moradia com vista mar", Description: "Moradia com piscina e jardim, na zona da praia.", Detected: true},
+		{Lang: "en", Title: "Sea view villa", Description: "Villa with a pool and a garden."},
+		{Lang: "fr", Title: "Villa vue mer"},
+		{Lang: "de", Description: "Wunderschönes Haus mit Garten und Blick auf das Meer.", Detected: true},
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("AdvertTexts[%d] = %+v, want %+v", i, texts[i], want[i])
+		}
+	}
+
+	// The single fields of older JSON are read as untagged
+	texts = AdvertTexts(map[string]interface{}{"Title": "Villa T4", "Description": "Villa with a pool, three bedrooms and a garden."}, "a2", report.New())
+	if len(texts) != 1 || texts[0].Lang != "en" || !texts[0].Detected {
+		t.Errorf("AdvertTexts of the single fields = %+v, want one detected en", texts)
+	}
+}
+
+func TestAdvertTextsTaggedBeforePortuguese(t *testing.T) {
+	// Languages we cannot detect keep their tag and never take the place of the Portuguese text
+	advert := map[string]interface{}{
+		"Titles": []interface{}{
+			map[string]interface{}{"Lang": "ru", "Text": "Квартира у моря"},
+			map[string]interface{}{"Lang": "sv", "Text": "Lägenhet vid havet"},
+			map[string]interface{}{"Lang": "pt", "Text": "Apartamento junto ao mar"},
+			map[string]interface{}{"Lang": "klingon language", "Text": "Qa'vam"},
+		},
+		"Descriptions": []interface{}{
+			map[string]interface{}{"Lang": "sv", "Text": "Lägenhet med havsutsikt"},
+			map[string]interface{}{"Lang": "pt", "Text": "Apartamento com vista mar."},
+		},
+	}
+
+	conversionReport := report.New()
+	texts := AdvertTexts(advert, "a3", conversionReport)
+	want := []LocalizedText{
+		{Lang: "pt", Title: "Apartamento junto ao mar", Description: "Apartamento com vista mar."},
+		{Lang: "ru", Title: "Квартира у моря"},
+		{Lang: "sv", Title: "Lägenhet vid havet", Description: "Lägenhet med havsutsikt"},
+	}
+	if len(texts) != len(want) {
+		t.Fatalf("AdvertTexts = %+v, want %+v", texts, want)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("AdvertTexts[%d] = %+v, want %+v", i, texts[i], want[i])
+		}
+	}
+	if len(conversionReport.Issues) != 1 || conversionReport.Issues[0].Code != ISSUE_INVALID_LANGUAGE {
+		t.Errorf("issues = %+v, want the unreadable tag reported", conversionReport.Issues)
+	}
+}
@@ -0,0 +1,161 @@
+package convert_to_rosetta
+
+import (
+	"errors"
+	"go-test/report"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Kinds of MovieURL
+const (
+	MEDIA_VIDEO        = "video"
+	MEDIA_VIRTUAL_TOUR = "virtual_tour"
+)
+
+// VirtualTourElement is the Rosetta element of the 3D tours; empty while Rosetta has none and the tours are left out
+var VirtualTourElement = ""
+
+var (
+	ErrUnsupportedMediaHost = errors.New("not a YouTube, Vimeo or Matterport link")
+	ErrInvalidMediaURL      = errors.New("no video or tour id in the link")
+)
+
+// Media is a video or a virtual tour with the canonical URL of its provider
+type Media struct {
+	Kind     string // MEDIA_VIDEO or MEDIA_VIRTUAL_TOUR
+	Provider string // youtube, vimeo, matterport
+	ID       string
+	URL      string
+}
+
+var (
+	iframeSourcePattern = regexp.MustCompile(`(?i)\bsrc\s*=\s*["']?([^"'\s>]+)`)
+	youtubeIDPattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	vimeoIDPattern      = regexp.MustCompile(`^[0-9]{6,12}$`)
+	vimeoHashPattern    = regexp.MustCompile(`^[0-9a-f]{6,20}$`)
+	matterportIDPattern = regexp.MustCompile(`^[A-Za-z0-9]{11}$`)
+)
+
+// NormalizeMediaURL finds the provider and the id of a share link, page, embed URL or <iframe> code
+func NormalizeMediaURL(raw string) (Media, error) {
+	raw = strings.TrimSpace(html.UnescapeString(raw))
+
+	// Embed codes: only the src of the iframe matters
+	if strings.Contains(raw, "<") {
+		match := iframeSourcePattern.FindStringSubmatch(raw)
+		if match == nil {
+			return Media{}, ErrInvalidMediaURL
+		}
+		raw = html.UnescapeString(match[1])
+	}
+	if strings.HasPrefix(raw, "//") {
+		raw = "https:" + raw
+	} else if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Hostname() == "" {
+		return Media{}, ErrInvalidMediaURL
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, prefix := range []string{"www.", "m.", "player.", "music."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+
+	switch host {
+	case "youtu.be":
+		return youtubeMedia(segments[0])
+	case "youtube.com", "youtube-nocookie.com":
+		if id := parsed.Query().Get("v"); id != "" {
+			return youtubeMedia(id)
+		}
+		if len(segments) >= 2 {
+			switch segments[0] {
+			case "embed", "shorts", "v", "live":
+				return youtubeMedia(segments[1])
+			}
+		}
+		return Media{}, ErrInvalidMediaURL
+
+	case "vimeo.com":
+		// vimeo.com/123, vimeo.com/123/hash (unlisted), vimeo.com/channels/x/123, player.vimeo.com/video/123?h=hash,
+		// vimeo.com/showcase/456/video/123: the id after "video" wins over the showcase or album one
+		start := 0
+		for i, segment := range segments {
+			if segment == "video" && i+1 < len(segments) {
+				start = i + 1
+			}
+		}
+		// A showcase or album alone is a list of videos, its id is not one of them
+		if start == 0 && (segments[0] == "showcase" || segments[0] == "album") {
+			return Media{}, ErrInvalidMediaURL
+		}
+		for i := start; i < len(segments); i++ {
+			segment := segments[i]
+			if !vimeoIDPattern.MatchString(segment) {
+				continue
+			}
+			hash := parsed.Query().Get("h")
+			if i+1 < len(segments) && vimeoHashPattern.MatchString(segments[i+1]) {
+				hash = segments[i+1]
+			}
+			media := Media{Kind: MEDIA_VIDEO, Provider: "vimeo", ID: segment, URL: "https://vimeo.com/" + segment}
+			if vimeoHashPattern.MatchString(hash) {
+				media.URL += "/" + hash
+			}
+			return media, nil
+		}
+		return Media{}, ErrInvalidMediaURL
+
+	case "matterport.com", "my.matterport.com":
+		// my.matterport.com/show/?m=id, matterport.com/discover/space/id
+		id := parsed.Query().Get("m")
+		if id == "" && len(segments) > 0 {
+			id = segments[len(segments)-1]
+		}
+		if !matterportIDPattern.MatchString(id) {
+			return Media{}, ErrInvalidMediaURL
+		}
+		return Media{Kind: MEDIA_VIRTUAL_TOUR, Provider: "matterport", ID: id, URL: "https://my.matterport.com/show/?m=" + id}, nil
+	}
+	return Media{}, ErrUnsupportedMediaHost
+}
+
+// MapMedia returns the <movie> (or virtual tour) element of MovieURL, nothing when the link is left out
+func MapMedia(movieURL string, externalID string, conversionReport *report.Report) string {
+	media, err := NormalizeMediaURL(movieURL)
+	if err != nil {
+		code := ISSUE_INVALID_VIDEO
+		if errors.Is(err, ErrUnsupportedMediaHost) {
+			code = ISSUE_UNSUPPORTED_VIDEO
+		}
+		conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: code, Message: "Video link left out: " + err.Error(), Field: "movie_url", Value: movieURL, ExternalID: externalID})
+		return ""
+	}
+
+	if media.Kind == MEDIA_VIRTUAL_TOUR {
+		if VirtualTourElement == "" {
+			conversionReport.Add(report.Issue{Level: report.LEVEL_INFO, Code: ISSUE_TOUR_LEFT_OUT, Message: "Virtual tours are not published on Rosetta, the " + media.Provider + " tour is left out", Field: "movie_url", Value: movieURL, ExternalID: externalID})
+			return ""
+		}
+		return "<" + VirtualTourElement + ">" + CDATA(media.URL) + "</" + VirtualTourElement + ">"
+	}
+
+	// Create <movie> element to XML with CDATA
+	return "<movie>" + CDATA(media.URL) + "</movie>"
+}
+
+//-------------------------------------------------------------------- Helpers
+
+// youtubeMedia checks the id and builds the watch URL
+func youtubeMedia(id string) (Media, error) {
+	if !youtubeIDPattern.MatchString(id) {
+		return Media{}, ErrInvalidMediaURL
+	}
+	return Media{Kind: MEDIA_VIDEO, Provider: "youtube", ID: id, URL: "https://www.youtube.com/watch?v=" + id}, nil
+}
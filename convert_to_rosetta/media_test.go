@@ -0,0 +1,49 @@
+package convert_to_rosetta
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeMediaURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		kind string
+		url  string
+		err  error
+	}{
+		// YouTube share links, pages, shorts and embeds
+		{"https://youtu.be/dQw4w9WgXcQ?si=abc", MEDIA_VIDEO, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", nil},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ&t=42s", MEDIA_VIDEO, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", nil},
+		{"www.youtube.com/shorts/dQw4w9WgXcQ", MEDIA_VIDEO, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", nil},
+		{`<iframe width="560" height="315" src="https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?rel=0" frameborder="0" allowfullscreen></iframe>`, MEDIA_VIDEO, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", nil},
+		{"&lt;iframe src=&quot;//www.youtube.com/embed/dQw4w9WgXcQ&quot;&gt;&lt;/iframe&gt;", MEDIA_VIDEO, "https://www.youtube.com/watch?v=dQw4w9WgXcQ", nil},
+		{"https://www.youtube.com/channel/UC123", "", "", ErrInvalidMediaURL},
+
+		// Vimeo pages, unlisted links and the player
+		{"https://vimeo.com/76979871", MEDIA_VIDEO, "https://vimeo.com/76979871", nil},
+		{"https://vimeo.com/channels/staffpicks/76979871", MEDIA_VIDEO, "https://vimeo.com/76979871", nil},
+		{"https://vimeo.com/76979871/4f5a6b7c8d", MEDIA_VIDEO, "https://vimeo.com/76979871/4f5a6b7c8d", nil},
+		{`<iframe src="https://player.vimeo.com/video/76979871?h=4f5a6b7c8d&amp;badge=0"></iframe>`, MEDIA_VIDEO, "https://vimeo.com/76979871/4f5a6b7c8d", nil},
+		{"https://vimeo.com/showcase/1234567/video/987654321", MEDIA_VIDEO, "https://vimeo.com/987654321", nil},
+		{"https://vimeo.com/album/1234567/video/987654321", MEDIA_VIDEO, "https://vimeo.com/987654321", nil},
+		{"https://vimeo.com/showcase/1234567", "", "", ErrInvalidMediaURL},
+		{"https://vimeo.com/album/1234567/", "", "", ErrInvalidMediaURL},
+
+		// Matterport tours
+		{"https://my.matterport.com/show/?m=SxQL3iGyoDo&play=1", MEDIA_VIRTUAL_TOUR, "https://my.matterport.com/show/?m=SxQL3iGyoDo", nil},
+		{"https://matterport.com/discover/space/SxQL3iGyoDo", MEDIA_VIRTUAL_TOUR, "https://my.matterport.com/show/?m=SxQL3iGyoDo", nil},
+
+		// Everything else
+		{"https://www.dailymotion.com/video/x7tgad0", "", "", ErrUnsupportedMediaHost},
+		{"https://arhome.pt/videos/apartamento.mp4", "", "", ErrUnsupportedMediaHost},
+		{"<p>Vídeo brevemente</p>", "", "", ErrInvalidMediaURL},
+	}
+
+	for _, test := range tests {
+		media, err := NormalizeMediaURL(test.raw)
+		if !errors.Is(err, test.err) || media.Kind != test.kind || media.URL != test.url {
+			t.Errorf("NormalizeMediaURL(%q) = %s %q, %v, want %s %q, %v", test.raw, media.Kind, media.URL, err, test.kind, test.url, test.err)
+		}
+	}
+}
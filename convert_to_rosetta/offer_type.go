@@ -0,0 +1,98 @@
+package convert_to_rosetta
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Offer types the category table knows
+const (
+	OFFER_TYPE_SALE     = "venda"
+	OFFER_TYPE_RENT     = "arrendamento"
+	OFFER_TYPE_TRANSFER = "trespasse" // business transfer, always the goodwill category (sold)
+)
+
+// defaultOfferTypes maps the sanitized values agencies send (Portuguese, English, Spanish) to an offer type.
+// Numeric codes differ from one CRM to the next, so none is built in: they go on CONVERT_OFFER_TYPES_FILE.
+// "Buy"/"comprar" are left out too, they are what a wanted ad says.
+var defaultOfferTypes = map[string]string{
+	// Sale
+	"venda": OFFER_TYPE_SALE, "vendas": OFFER_TYPE_SALE, "vende_se": OFFER_TYPE_SALE, "vendo": OFFER_TYPE_SALE,
+	"para_venda": OFFER_TYPE_SALE, "a_venda": OFFER_TYPE_SALE,
+	"sale": OFFER_TYPE_SALE, "sell": OFFER_TYPE_SALE, "for_sale": OFFER_TYPE_SALE,
+	"venta": OFFER_TYPE_SALE, "se_vende": OFFER_TYPE_SALE, "en_venta": OFFER_TYPE_SALE,
+
+	// Rent, holiday rentals included (the category tells them apart)
+	"arrendamento": OFFER_TYPE_RENT, "arrendar": OFFER_TYPE_RENT, "arrenda_se": OFFER_TYPE_RENT, "arrendo": OFFER_TYPE_RENT,
+	"aluguer": OFFER_TYPE_RENT, "aluguel": OFFER_TYPE_RENT, "alugar": OFFER_TYPE_RENT, "aluga_se": OFFER_TYPE_RENT, "alugo": OFFER_TYPE_RENT,
+	"para_arrendar": OFFER_TYPE_RENT, "ferias": OFFER_TYPE_RENT, "arrendamento_de_ferias": OFFER_TYPE_RENT,
+	"rent": OFFER_TYPE_RENT, "rental": OFFER_TYPE_RENT, "for_rent": OFFER_TYPE_RENT, "let": OFFER_TYPE_RENT, "to_let": OFFER_TYPE_RENT,
+	"lease": OFFER_TYPE_RENT, "holiday_rental": OFFER_TYPE_RENT, "vacation_rental": OFFER_TYPE_RENT,
+	"alquiler": OFFER_TYPE_RENT, "alquilar": OFFER_TYPE_RENT, "se_alquila": OFFER_TYPE_RENT, "en_alquiler": OFFER_TYPE_RENT,
+	"arriendo": OFFER_TYPE_RENT, "alquiler_vacacional": OFFER_TYPE_RENT,
+
+	// Business transfer
+	"trespasse": OFFER_TYPE_TRANSFER, "trespassa_se": OFFER_TYPE_TRANSFER, "trespasso": OFFER_TYPE_TRANSFER,
+	"transfer": OFFER_TYPE_TRANSFER, "business_transfer": OFFER_TYPE_TRANSFER, "goodwill": OFFER_TYPE_TRANSFER,
+	"traspaso": OFFER_TYPE_TRANSFER, "se_traspasa": OFFER_TYPE_TRANSFER,
+}
+
+var (
+	offerTypesMu sync.RWMutex
+	offerTypes   = defaultOfferTypes
+)
+
+// LoadOfferTypes adds (or overrides) synonyms from a JSON object of raw value -> "venda", "arrendamento" or "trespasse"
+func LoadOfferTypes(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var extra map[string]string
+	if err := json.Unmarshal(content, &extra); err != nil {
+		return fmt.Errorf("Error reading offer types file %s: %v", path, err)
+	}
+
+	merged := make(map[string]string, len(defaultOfferTypes)+len(extra))
+	for raw, offerType := range defaultOfferTypes {
+		merged[raw] = offerType
+	}
+	for raw, offerType := range extra {
+		switch offerType {
+		case OFFER_TYPE_SALE, OFFER_TYPE_RENT, OFFER_TYPE_TRANSFER:
+		default:
+			return fmt.Errorf("offer type '%s' of '%s' is not venda, arrendamento or trespasse", offerType, raw)
+		}
+		merged[normalizeOfferTypeKey(raw)] = offerType
+	}
+
+	offerTypesMu.Lock()
+	offerTypes = merged
+	offerTypesMu.Unlock()
+	return nil
+}
+
+// NormalizeOfferType returns OFFER_TYPE_SALE, OFFER_TYPE_RENT or OFFER_TYPE_TRANSFER; false when the value is not recognized
+func NormalizeOfferType(raw string) (string, bool) {
+	key := normalizeOfferTypeKey(raw)
+	if key == "" {
+		return "", false
+	}
+
+	offerTypesMu.RLock()
+	defer offerTypesMu.RUnlock()
+	offerType, known := offerTypes[key]
+	return offerType, known
+}
+
+// normalizeOfferTypeKey sanitizes the value and drops the dots and leading zeros of codes ("Vende-se.", "01")
+func normalizeOfferTypeKey(raw string) string {
+	key := SanitizeString(strings.Trim(strings.TrimSpace(raw), "."))
+	if trimmed := strings.TrimLeft(key, "0"); trimmed != "" && strings.Trim(trimmed, "0123456789") == "" {
+		key = trimmed
+	}
+	return key
+}
@@ -0,0 +1,67 @@
+package convert_to_rosetta
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeOfferType(t *testing.T) {
+	tests := []struct {
+		raw       string
+		offerType string
+		known     bool
+	}{
+		{"Venda", OFFER_TYPE_SALE, true},
+		{"Vende-se.", OFFER_TYPE_SALE, true},
+		{"For Sale", OFFER_TYPE_SALE, true},
+		{"Venta", OFFER_TYPE_SALE, true},
+		{"Arrendamento", OFFER_TYPE_RENT, true},
+		{"Aluguer", OFFER_TYPE_RENT, true},
+		{"Arrendar", OFFER_TYPE_RENT, true},
+		{" RENT ", OFFER_TYPE_RENT, true},
+		{"Alquiler", OFFER_TYPE_RENT, true},
+		{"Trespasse", OFFER_TYPE_TRANSFER, true},
+		{"Traspaso", OFFER_TYPE_TRANSFER, true},
+		{"", "", false},
+		{"Permuta", "", false},
+		{"9", "", false},
+
+		// Numeric codes depend on the CRM, and "buy" is a wanted ad: none is guessed
+		{"1", "", false},
+		{"02", "", false},
+		{"Buy", "", false},
+		{"Comprar", "", false},
+	}
+
+	for _, test := range tests {
+		offerType, known := NormalizeOfferType(test.raw)
+		if offerType != test.offerType || known != test.known {
+			t.Errorf("NormalizeOfferType(%q) = %q, %v, want %q, %v", test.raw, offerType, known, test.offerType, test.known)
+		}
+	}
+}
+
+func TestLoadOfferTypes(t *testing.T) {
+	defer func() { offerTypes = defaultOfferTypes }()
+
+	path := filepath.Join(t.TempDir(), "offer_types.json")
+	os.WriteFile(path, []byte(`{"Aluguer temporário": "arrendamento", "09": "venda"}`), 0644)
+	if err := LoadOfferTypes(path); err != nil {
+		t.Fatal(err)
+	}
+	if offerType, _ := NormalizeOfferType("aluguer temporario"); offerType != OFFER_TYPE_RENT {
+		t.Errorf("configured synonym = %q, want %q", offerType, OFFER_TYPE_RENT)
+	}
+	if offerType, _ := NormalizeOfferType("9"); offerType != OFFER_TYPE_SALE {
+		t.Errorf("configured code = %q, want %q", offerType, OFFER_TYPE_SALE)
+	}
+	if offerType, _ := NormalizeOfferType("Sale"); offerType != OFFER_TYPE_SALE {
+		t.Errorf("built in synonym lost after loading the file: %q", offerType)
+	}
+
+	os.WriteFile(path, []byte(`{"permuta": "swap"}`), 0644)
+	if err := LoadOfferTypes(path); err == nil {
+		t.Error("offer type outside the table was accepted")
+	}
+}
@@ -0,0 +1,118 @@
+package convert_to_rosetta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"strings"
+	"unicode/utf8"
+)
+
+// CDATA wraps text in a CDATA section, splitting any "]]>" inside it and dropping characters XML doesn't allow
+func CDATA(text string) string {
+	text = strings.ReplaceAll(validXMLText(text), "]]>", "]]]]><![CDATA[>")
+	return "<![CDATA[" + text + "]]>"
+}
+
+// EscapeText escapes text for element content outside CDATA
+func EscapeText(text string) string {
+	var buffer bytes.Buffer
+	xml.EscapeText(&buffer, []byte(validXMLText(text)))
+	return buffer.String()
+}
+
+// validXMLText removes invalid UTF-8 and the characters outside the XML 1.0 Char range
+func validXMLText(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError:
+			return -1
+		case r == 0x09 || r == 0x0A || r == 0x0D:
+			return r
+		case r >= 0x20 && r <= 0xD7FF, r >= 0xE000 && r <= 0xFFFD, r >= 0x10000 && r <= 0x10FFFF:
+			return r
+		}
+		return -1
+	}, text)
+}
+
+// CanonicalSHA256 is the checksum of the compact output, the same whether it is pretty printed or not
+func CanonicalSHA256(compactXML string) string {
+	sum := sha256.Sum256([]byte(compactXML))
+	return hex.EncodeToString(sum[:])
+}
+
+// PrettyPrintXML indents the compact XML built by ConvertJSONToRosetta, two spaces per level.
+// Elements holding only text or CDATA stay on one line and CDATA content is never touched.
+func PrettyPrintXML(compactXML string) string {
+	var builder strings.Builder
+	depth := 0
+	rest := compactXML
+
+	// Was the last thing written an opening tag whose text is on the same line?
+	inlineOpen := false
+
+	for len(rest) > 0 {
+		switch {
+		case strings.HasPrefix(rest, "<![CDATA["):
+			end := strings.Index(rest, "]]>")
+			if end < 0 {
+				builder.WriteString(rest)
+				return builder.String()
+			}
+			builder.WriteString(rest[:end+3])
+			rest = rest[end+3:]
+
+		case strings.HasPrefix(rest, "</"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				builder.WriteString(rest)
+				return builder.String()
+			}
+			depth--
+			if !inlineOpen {
+				writeIndent(&builder, depth)
+			}
+			builder.WriteString(rest[:end+1])
+			inlineOpen = false
+			rest = rest[end+1:]
+
+		case strings.HasPrefix(rest, "<"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				builder.WriteString(rest)
+				return builder.String()
+			}
+			writeIndent(&builder, depth)
+			builder.WriteString(rest[:end+1])
+			rest = rest[end+1:]
+
+			// Self closing tags don't open a level
+			if strings.HasSuffix(builder.String(), "/>") {
+				inlineOpen = false
+				continue
+			}
+			depth++
+
+			// Keep <tag>text</tag> together
+			inlineOpen = !strings.HasPrefix(rest, "<") || strings.HasPrefix(rest, "<![CDATA[") || strings.HasPrefix(rest, "</")
+
+		default:
+			end := strings.IndexByte(rest, '<')
+			if end < 0 {
+				end = len(rest)
+			}
+			builder.WriteString(rest[:end])
+			rest = rest[end:]
+		}
+	}
+
+	builder.WriteString("\n")
+	return strings.TrimPrefix(builder.String(), "\n")
+}
+
+func writeIndent(builder *strings.Builder, depth int) {
+	builder.WriteString("\n")
+	builder.WriteString(strings.Repeat("  ", depth))
+}
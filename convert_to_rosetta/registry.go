@@ -0,0 +1,262 @@
+package convert_to_rosetta
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Value types of the registry entries
+const (
+	ATTRIBUTE_TYPE_NUMBER  = "number"
+	ATTRIBUTE_TYPE_ENUM    = "enum"
+	ATTRIBUTE_TYPE_BOOLEAN = "boolean"
+	ATTRIBUTE_TYPE_MULTI   = "multi"
+)
+
+// Conversion rules of the registry entries
+const (
+	ATTRIBUTE_RULE_URN_VALUES  = "urn_values"         // reverse lookup on urnValues (default for enum and multi)
+	ATTRIBUTE_RULE_MAP         = "map"                // only the "values" table
+	ATTRIBUTE_RULE_AREA        = "area"               // ParseArea, any unit to square metres
+	ATTRIBUTE_RULE_CERTIFICATE = "energy_certificate" // NormalizeCertificate
+)
+
+// defaultAttributes is the built in registry, see attributes.json
+//
+//go:embed attributes.json
+var defaultAttributes []byte
+
+// AttributeDefinition describes how an <attribute><name> is converted
+type AttributeDefinition struct {
+	Names   []string          `json:"names"` // sanitized names (SanitizeString)
+	URN     string            `json:"urn"`
+	Type    string            `json:"type"`
+	Rule    string            `json:"rule,omitempty"`
+	Values  map[string]string `json:"values,omitempty"` // sanitized raw value -> output, checked before the rule
+	Append  bool              `json:"append,omitempty"` // add to the values of the URN instead of replacing them
+	Integer bool              `json:"integer,omitempty"`
+	Min     *float64          `json:"min,omitempty"`
+	Max     *float64          `json:"max,omitempty"`
+
+	// Booleans: what to emit for yes and no (defaults urn:concept:yes and urn:concept:no unless appending)
+	TrueValue  string `json:"true_value,omitempty"`
+	FalseValue string `json:"false_value,omitempty"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   map[string]AttributeDefinition
+)
+
+var booleanValues = map[string]bool{
+	"sim": true, "s": true, "yes": true, "y": true, "true": true, "1": true, "x": true, "com": true,
+	"nao": false, "n": false, "no": false, "false": false, "0": false, "sem": false,
+}
+
+func init() {
+	definitions, err := parseAttributeDefinitions(defaultAttributes)
+	if err != nil {
+		panic("invalid built in attributes.json: " + err.Error())
+	}
+	registry = indexAttributeDefinitions(definitions, nil)
+}
+
+// LoadAttributeRegistry adds (or overrides, by name) the definitions found in a JSON file
+func LoadAttributeRegistry(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	definitions, err := parseAttributeDefinitions(content)
+	if err != nil {
+		return fmt.Errorf("Error reading attributes file %s: %v", path, err)
+	}
+
+	registryMu.Lock()
+	registry = indexAttributeDefinitions(definitions, registry)
+	registryMu.Unlock()
+	return nil
+}
+
+// LookupAttribute returns the definition for a sanitized attribute name
+func LookupAttribute(name string) (AttributeDefinition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	definition, exists := registry[name]
+	return definition, exists
+}
+
+// Convert turns a raw value into the output values; false when it can't be mapped
+func (d AttributeDefinition) Convert(raw string) ([]string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, false
+	}
+
+	// Explicit values always win
+	if value, exists := d.Values[SanitizeString(raw)]; exists {
+		return []string{value}, true
+	}
+
+	// Then the synonyms added on the mapping editor
+	if urn := lookupSynonym(d.URN, SanitizeString(raw)); urn != "" {
+		return []string{urn}, true
+	}
+
+	switch d.Type {
+	case ATTRIBUTE_TYPE_NUMBER:
+		return d.convertNumber(raw)
+	case ATTRIBUTE_TYPE_BOOLEAN:
+		return d.convertBoolean(raw)
+	}
+
+	switch d.Rule {
+	case ATTRIBUTE_RULE_MAP:
+		return d.convertList(raw)
+	case ATTRIBUTE_RULE_CERTIFICATE:
+		if class := ConvertCertificate(raw); class != "" {
+			return []string{class}, true
+		}
+		return nil, false
+	}
+
+	// Default rule: reverse urnValues lookup on the whole value
+	if conversion := Convert(SanitizeString(raw), true); conversion != "" {
+		return []string{conversion}, true
+	}
+	return d.convertList(raw)
+}
+
+// convertList converts multi values sent as a comma separated list, every item or none
+func (d AttributeDefinition) convertList(raw string) ([]string, bool) {
+	if d.Type != ATTRIBUTE_TYPE_MULTI || !strings.Contains(raw, ",") {
+		return nil, false
+	}
+
+	var converted []string
+	for _, item := range strings.Split(raw, ",") {
+		item = SanitizeString(strings.TrimSpace(item))
+		conversion, exists := d.Values[item]
+		if !exists {
+			conversion = lookupSynonym(d.URN, item)
+		}
+		if conversion == "" && d.Rule != ATTRIBUTE_RULE_MAP {
+			conversion = Convert(item, true)
+		}
+		if conversion == "" {
+			return nil, false
+		}
+		converted = append(converted, conversion)
+	}
+	return converted, true
+}
+
+// IsMulti tells if the values accumulate on the URN
+func (d AttributeDefinition) IsMulti() bool {
+	return d.Type == ATTRIBUTE_TYPE_MULTI || d.Append
+}
+
+func (d AttributeDefinition) convertNumber(raw string) ([]string, bool) {
+	var number float64
+	var ok bool
+	if d.Rule == ATTRIBUTE_RULE_AREA {
+		number, ok = ParseArea(raw)
+	} else {
+		number, ok = parseDecimal(strings.ReplaceAll(raw, " ", ""))
+	}
+	if !ok {
+		return nil, false
+	}
+
+	if d.Integer && number != math.Trunc(number) {
+		return nil, false
+	}
+	if (d.Min != nil && number < *d.Min) || (d.Max != nil && number > *d.Max) {
+		return nil, false
+	}
+
+	return []string{strconv.FormatFloat(math.Round(number*100)/100, 'f', -1, 64)}, true
+}
+
+func (d AttributeDefinition) convertBoolean(raw string) ([]string, bool) {
+	value, known := booleanValues[SanitizeString(raw)]
+	if !known {
+		return nil, false
+	}
+
+	trueValue, falseValue := d.TrueValue, d.FalseValue
+	if !d.Append {
+		if trueValue == "" {
+			trueValue = "urn:concept:yes"
+		}
+		if falseValue == "" {
+			falseValue = "urn:concept:no"
+		}
+	}
+
+	if value {
+		return []string{trueValue}, true
+	}
+	if falseValue == "" {
+		// Nothing to emit for "no" on an appended characteristic, but the value was understood
+		return []string{}, true
+	}
+	return []string{falseValue}, true
+}
+
+//-------------------------------------------------------------------- Helpers
+
+func parseAttributeDefinitions(content []byte) ([]AttributeDefinition, error) {
+	var definitions []AttributeDefinition
+	if err := json.Unmarshal(content, &definitions); err != nil {
+		return nil, err
+	}
+
+	for i, definition := range definitions {
+		if len(definition.Names) == 0 || definition.URN == "" {
+			return nil, fmt.Errorf("entry %d needs names and urn", i)
+		}
+		switch definition.Type {
+		case ATTRIBUTE_TYPE_NUMBER, ATTRIBUTE_TYPE_ENUM, ATTRIBUTE_TYPE_BOOLEAN, ATTRIBUTE_TYPE_MULTI:
+		default:
+			return nil, fmt.Errorf("entry %d has unknown type '%s'", i, definition.Type)
+		}
+		switch definition.Rule {
+		case "", ATTRIBUTE_RULE_URN_VALUES, ATTRIBUTE_RULE_MAP, ATTRIBUTE_RULE_AREA, ATTRIBUTE_RULE_CERTIFICATE:
+		default:
+			return nil, fmt.Errorf("entry %d has unknown rule '%s'", i, definition.Rule)
+		}
+		if definition.Type == ATTRIBUTE_TYPE_BOOLEAN && definition.Append && definition.TrueValue == "" {
+			return nil, fmt.Errorf("entry %d appends a boolean without true_value", i)
+		}
+
+		// Keys of the values table are compared sanitized
+		if len(definition.Values) > 0 {
+			values := make(map[string]string, len(definition.Values))
+			for raw, value := range definition.Values {
+				values[SanitizeString(raw)] = value
+			}
+			definitions[i].Values = values
+		}
+	}
+	return definitions, nil
+}
+
+func indexAttributeDefinitions(definitions []AttributeDefinition, base map[string]AttributeDefinition) map[string]AttributeDefinition {
+	index := make(map[string]AttributeDefinition, len(base)+len(definitions))
+	for name, definition := range base {
+		index[name] = definition
+	}
+	for _, definition := range definitions {
+		for _, name := range definition.Names {
+			index[SanitizeString(name)] = definition
+		}
+	}
+	return index
+}
@@ -0,0 +1,194 @@
+package convert_to_rosetta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Synonym maps one raw agency value of an attribute kind to an existing URN
+type Synonym struct {
+	TypeURN string `json:"type_urn"` // "urn:concept:characteristics"...
+	Value   string `json:"value"`    // sanitized raw value (SanitizeString)
+	URN     string `json:"urn"`      // one of the urnValues keys
+}
+
+// URNValue is one entry of urnValues, for the mapping editor search
+type URNValue struct {
+	URN   string `json:"urn"`
+	Value string `json:"value"`
+}
+
+// ErrSynonymsNotSaved wraps the file errors: the change was rolled back, the request itself was fine
+var ErrSynonymsNotSaved = errors.New("synonyms could not be saved")
+
+var (
+	synonymsMu   sync.RWMutex
+	synonymsPath string
+	synonyms     = map[string]map[string]string{} // type URN -> sanitized value -> URN
+)
+
+// LoadSynonyms reads the synonyms added by the operators; a missing file is an empty store
+func LoadSynonyms(path string) error {
+	var list []Synonym
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &list); err != nil {
+			return fmt.Errorf("Error reading synonyms file %s: %v", path, err)
+		}
+	}
+
+	loaded := map[string]map[string]string{}
+	for _, synonym := range list {
+		if loaded[synonym.TypeURN] == nil {
+			loaded[synonym.TypeURN] = map[string]string{}
+		}
+		loaded[synonym.TypeURN][SanitizeString(synonym.Value)] = synonym.URN
+	}
+
+	synonymsMu.Lock()
+	synonymsPath = path
+	synonyms = loaded
+	synonymsMu.Unlock()
+	return nil
+}
+
+// AddSynonym maps a raw value of the attribute kind to an existing URN and saves the store
+func AddSynonym(typeURN string, value string, urn string) (Synonym, error) {
+	synonym := Synonym{TypeURN: typeURN, Value: SanitizeString(strings.TrimSpace(value)), URN: urn}
+	if synonym.Value == "" {
+		return Synonym{}, fmt.Errorf("value is empty")
+	}
+	if !KnownURN(urn) {
+		return Synonym{}, fmt.Errorf("'%s' is not a known URN", urn)
+	}
+	if !knownTypeURN(typeURN) {
+		return Synonym{}, fmt.Errorf("'%s' is not an attribute of the registry", typeURN)
+	}
+
+	// The lookups wait on the lock, so nobody sees the change before the file has it
+	synonymsMu.Lock()
+	defer synonymsMu.Unlock()
+	if synonyms[typeURN] == nil {
+		synonyms[typeURN] = map[string]string{}
+	}
+	previous, existed := synonyms[typeURN][synonym.Value]
+	synonyms[typeURN][synonym.Value] = urn
+	if err := saveSynonyms(); err != nil {
+		if existed {
+			synonyms[typeURN][synonym.Value] = previous
+		} else {
+			delete(synonyms[typeURN], synonym.Value)
+		}
+		return Synonym{}, fmt.Errorf("%w: %v", ErrSynonymsNotSaved, err)
+	}
+	return synonym, nil
+}
+
+// RemoveSynonym drops a synonym and saves the store
+func RemoveSynonym(typeURN string, value string) error {
+	value = SanitizeString(strings.TrimSpace(value))
+
+	synonymsMu.Lock()
+	defer synonymsMu.Unlock()
+	previous, exists := synonyms[typeURN][value]
+	if !exists {
+		return fmt.Errorf("no synonym '%s' for '%s'", value, typeURN)
+	}
+	delete(synonyms[typeURN], value)
+	if err := saveSynonyms(); err != nil {
+		synonyms[typeURN][value] = previous
+		return fmt.Errorf("%w: %v", ErrSynonymsNotSaved, err)
+	}
+	return nil
+}
+
+// Synonyms lists the store sorted by attribute kind and value
+func Synonyms() []Synonym {
+	synonymsMu.RLock()
+	defer synonymsMu.RUnlock()
+	return synonymList()
+}
+
+// KnownURN tells if the URN is one of urnValues
+func KnownURN(urn string) bool {
+	_, exists := urnValues[urn]
+	return exists
+}
+
+// SearchURNs finds the urnValues whose URN or value contains the query, at most limit of them
+func SearchURNs(query string, limit int) []URNValue {
+	query = SanitizeString(strings.TrimSpace(query))
+	found := []URNValue{}
+	for urn, value := range urnValues {
+		if query == "" || strings.Contains(SanitizeString(urn), query) || strings.Contains(value, query) {
+			found = append(found, URNValue{URN: urn, Value: value})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].URN < found[j].URN
+	})
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
+
+//-------------------------------------------------------------------- Helpers
+
+// lookupSynonym returns the URN an operator assigned to the sanitized value, "" when none
+func lookupSynonym(typeURN string, value string) string {
+	synonymsMu.RLock()
+	defer synonymsMu.RUnlock()
+	return synonyms[typeURN][value]
+}
+
+func knownTypeURN(typeURN string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, definition := range registry {
+		if definition.URN == typeURN {
+			return true
+		}
+	}
+	return false
+}
+
+func synonymList() []Synonym {
+	list := []Synonym{}
+	for typeURN, values := range synonyms {
+		for value, urn := range values {
+			list = append(list, Synonym{TypeURN: typeURN, Value: value, URN: urn})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].TypeURN != list[j].TypeURN {
+			return list[i].TypeURN < list[j].TypeURN
+		}
+		return list[i].Value < list[j].Value
+	})
+	return list
+}
+
+// saveSynonyms writes the store atomically; callers hold the lock
+func saveSynonyms() error {
+	if synonymsPath == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(synonymList(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := synonymsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, synonymsPath)
+}
@@ -0,0 +1,70 @@
+package convert_to_rosetta
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSynonyms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "synonyms.json")
+	if err := LoadSynonyms(path); err != nil {
+		t.Fatalf("LoadSynonyms on a missing file: %v", err)
+	}
+	t.Cleanup(func() { LoadSynonyms(filepath.Join(t.TempDir(), "none.json")) })
+
+	characteristics, _ := LookupAttribute("caracteristicas")
+	if _, converted := characteristics.Convert("Porta Blindada/Segurança"); converted {
+		t.Fatal("value already mapped before adding the synonym")
+	}
+
+	// Unknown URNs and attribute kinds are refused
+	if _, err := AddSynonym(characteristics.URN, "Porta Blindada/Segurança", "urn:concept:does-not-exist"); err == nil {
+		t.Error("AddSynonym accepted an unknown URN")
+	}
+	if _, err := AddSynonym("urn:concept:not-an-attribute", "Porta Blindada/Segurança", "urn:concept:alarm"); err == nil {
+		t.Error("AddSynonym accepted an unknown attribute kind")
+	}
+
+	if _, err := AddSynonym(characteristics.URN, "Porta Blindada/Segurança", "urn:concept:alarm"); err != nil {
+		t.Fatalf("AddSynonym: %v", err)
+	}
+	if values, converted := characteristics.Convert("porta blindada/segurança"); !converted || values[0] != "urn:concept:alarm" {
+		t.Errorf("Convert after AddSynonym = %v, %v", values, converted)
+	}
+	if values, converted := characteristics.Convert("Alarme, Porta Blindada/Segurança"); !converted || len(values) != 2 {
+		t.Errorf("Convert of a list with a synonym = %v, %v", values, converted)
+	}
+
+	// The store survives a reload
+	if err := LoadSynonyms(path); err != nil {
+		t.Fatalf("LoadSynonyms: %v", err)
+	}
+	if list := Synonyms(); len(list) != 1 || list[0].Value != "porta_blindada_seguranca" {
+		t.Errorf("Synonyms after reload = %+v", list)
+	}
+
+	if err := RemoveSynonym(characteristics.URN, "Porta Blindada/Segurança"); err != nil {
+		t.Fatalf("RemoveSynonym: %v", err)
+	}
+	if _, converted := characteristics.Convert("Porta Blindada/Segurança"); converted {
+		t.Error("value still mapped after RemoveSynonym")
+	}
+}
+
+func TestSynonymsNotSaved(t *testing.T) {
+	// The directory does not exist: loading works (no file yet), saving fails
+	path := filepath.Join(t.TempDir(), "missing", "synonyms.json")
+	if err := LoadSynonyms(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { LoadSynonyms(filepath.Join(t.TempDir(), "none.json")) })
+
+	characteristics, _ := LookupAttribute("caracteristicas")
+	if _, err := AddSynonym(characteristics.URN, "Porta Blindada/Segurança", "urn:concept:alarm"); !errors.Is(err, ErrSynonymsNotSaved) {
+		t.Fatalf("AddSynonym with an unwritable file = %v, want ErrSynonymsNotSaved", err)
+	}
+	if _, converted := characteristics.Convert("Porta Blindada/Segurança"); converted || len(Synonyms()) != 0 {
+		t.Error("synonym kept in memory although it was not saved")
+	}
+}
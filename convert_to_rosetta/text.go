@@ -0,0 +1,316 @@
+package convert_to_rosetta
+
+import (
+	"fmt"
+	"go-test/report"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Description formats
+const (
+	TEXT_FORMAT_HTML  = "html" // allowlisted tags kept, without attributes
+	TEXT_FORMAT_PLAIN = "text" // every tag goes, block tags become line breaks
+)
+
+// Put in place of the phone numbers and emails
+const CONTACT_PLACEHOLDER = "[contacto removido]"
+
+// Added where a text is cut
+const TRUNCATION_MARK = "…"
+
+// TextRules are the cleanup rules of titles and descriptions
+type TextRules struct {
+	DescriptionFormat    string   // TEXT_FORMAT_HTML or TEXT_FORMAT_PLAIN
+	AllowedTags          []string // kept on HTML descriptions
+	RedactContacts       bool     // phone numbers and emails go, agencies must be contacted through the portal
+	MaxTitleLength       int      // characters, 0 for no limit
+	MaxDescriptionLength int      // visible characters (tags not counted), 0 for no limit
+}
+
+// Text holds the rules every conversion uses, set from the configuration
+var Text = TextRules{
+	DescriptionFormat:    TEXT_FORMAT_HTML,
+	AllowedTags:          []string{"p", "br", "b", "strong", "i", "em", "u", "ul", "ol", "li"},
+	RedactContacts:       true,
+	MaxTitleLength:       0,
+	MaxDescriptionLength: 10000,
+}
+
+// TextChanges says what the cleanup did that the agency should know about
+type TextChanges struct {
+	Redacted       int // contacts replaced by CONTACT_PLACEHOLDER
+	OriginalLength int // visible characters before the cut
+	Truncated      bool
+}
+
+// Tags that start a new line on plain text
+var blockTags = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "ul": true, "ol": true, "tr": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "blockquote": true, "hr": true, "section": true,
+}
+
+// Tags without a closing one
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true, "wbr": true}
+
+var (
+	tagPattern         = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)\b[^<>]*?(/?)>`)
+	escapedTagPattern  = regexp.MustCompile(`(?i)&lt;/?[a-z][a-z0-9]*\b[^&]*?&gt;`)
+	droppedBlocks      = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>|<!--.*?-->`)
+	spacesPattern      = regexp.MustCompile(`[ \t\f\v]+`)
+	blankLinesPattern  = regexp.MustCompile(`\n{3,}`)
+	emailPattern       = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)
+	portuguesePhone    = regexp.MustCompile(`(?:(?:\+|\b00)\s?351[\s.-]?[29][0-9]{2}[\s.-]?[0-9]{3}[\s.-]?[0-9]{3}|\b[29][0-9]{2}[\s.-][0-9]{3}[\s.-][0-9]{3})\b`)
+	internationalPhone = regexp.MustCompile(`(?:\+[1-9][0-9]{0,2}(?:[\s.-]?[0-9]){7,13}|\b00[1-9][0-9]{0,2}(?:[\s.-][0-9]{2,4}){2,5})\b`)
+)
+
+// CleanTitle returns the title as a single line of plain text within MaxTitleLength
+func CleanTitle(raw string) (string, TextChanges) {
+	var changes TextChanges
+	text := plainText(decodeEscapedTags(raw))
+	text = strings.Join(strings.Fields(text), " ")
+	if Text.RedactContacts {
+		text, changes.Redacted = redactContacts(text)
+	}
+	changes.OriginalLength = utf8.RuneCountInString(text)
+	text, changes.Truncated = truncateAtWord(text, Text.MaxTitleLength, false)
+	return text, changes
+}
+
+// CleanDescription returns the description with the allowlisted tags (or as plain text), tidy whitespace and within MaxDescriptionLength
+func CleanDescription(raw string) (string, TextChanges) {
+	var changes TextChanges
+	keepHTML := Text.DescriptionFormat == TEXT_FORMAT_HTML
+
+	var text string
+	if keepHTML {
+		text = allowlistedHTML(decodeEscapedTags(raw), Text.AllowedTags)
+	} else {
+		text = plainText(decodeEscapedTags(raw))
+	}
+	text = normalizeWhitespace(text)
+	if Text.RedactContacts {
+		text, changes.Redacted = redactContacts(text)
+	}
+	changes.OriginalLength = visibleLength(text, keepHTML)
+	text, changes.Truncated = truncateAtWord(text, Text.MaxDescriptionLength, keepHTML)
+	return text, changes
+}
+
+// textIssues tells the agency about the cut and the removed contacts of a title or description
+func textIssues(field string, changes TextChanges, maxLength int, externalID string, conversionReport *report.Report) {
+	if changes.Truncated {
+		conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_TEXT_TRUNCATED, Message: fmt.Sprintf("%s has %d characters, cut at %d", strings.ToUpper(field[:1])+field[1:], changes.OriginalLength, maxLength), Field: field, Value: strconv.Itoa(changes.OriginalLength), ExternalID: externalID})
+	}
+	if changes.Redacted > 0 {
+		conversionReport.Add(report.Issue{Level: report.LEVEL_INFO, Code: ISSUE_CONTACT_REDACTED, Message: fmt.Sprintf("%d phone number(s) or email(s) removed from the %s", changes.Redacted, field), Field: field, ExternalID: externalID})
+	}
+}
+
+//-------------------------------------------------------------------- Helpers
+
+// decodeEscapedTags turns "&lt;p&gt;" into "<p>" when the CRM escaped the whole fragment
+func decodeEscapedTags(raw string) string {
+	if !tagPattern.MatchString(raw) && escapedTagPattern.MatchString(raw) {
+		return html.UnescapeString(raw)
+	}
+	return raw
+}
+
+// plainText drops every tag, block tags become line breaks, and decodes the entities
+func plainText(raw string) string {
+	raw = droppedBlocks.ReplaceAllString(raw, " ")
+
+	var builder strings.Builder
+	last := 0
+	for _, match := range tagPattern.FindAllStringSubmatchIndex(raw, -1) {
+		builder.WriteString(decodeText(raw[last:match[0]]))
+		last = match[1]
+
+		// List items are dashes, their end leaves the line to the next one
+		name := strings.ToLower(raw[match[4]:match[5]])
+		if name == "li" {
+			if raw[match[2]:match[3]] == "" {
+				builder.WriteString("\n- ")
+			}
+		} else if blockTags[name] {
+			builder.WriteString("\n")
+		}
+	}
+	builder.WriteString(decodeText(raw[last:]))
+	return builder.String()
+}
+
+// allowlistedHTML keeps the allowed tags without their attributes, drops the rest and escapes the text
+func allowlistedHTML(raw string, allowedTags []string) string {
+	allowed := map[string]bool{}
+	for _, tag := range allowedTags {
+		allowed[strings.ToLower(strings.TrimSpace(tag))] = true
+	}
+	raw = droppedBlocks.ReplaceAllString(raw, " ")
+
+	var builder strings.Builder
+	var open []string
+	last := 0
+	for _, match := range tagPattern.FindAllStringSubmatchIndex(raw, -1) {
+		builder.WriteString(escapeText(decodeText(raw[last:match[0]])))
+		last = match[1]
+
+		closing := raw[match[2]:match[3]] == "/"
+		name := strings.ToLower(raw[match[4]:match[5]])
+		switch {
+		case !allowed[name]:
+			if blockTags[name] {
+				builder.WriteString("\n")
+			}
+		case voidTags[name]:
+			if !closing {
+				builder.WriteString("<" + name + ">")
+			}
+		case !closing:
+			open = append(open, name)
+			builder.WriteString("<" + name + ">")
+		default:
+			// Close only what is open, the stray closing tags of CRMs would break the page
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != name {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					builder.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+	builder.WriteString(escapeText(decodeText(raw[last:])))
+	for i := len(open) - 1; i >= 0; i-- {
+		builder.WriteString("</" + open[i] + ">")
+	}
+	return builder.String()
+}
+
+// decodeText decodes the entities and drops the control and zero width characters
+func decodeText(text string) string {
+	text = html.UnescapeString(text)
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r == '\u00a0' || r == '\u2007' || r == '\u202f':
+			return ' '
+		case r == '\u200b' || r == '\u200c' || r == '\u200d' || r == '\ufeff' || unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, strings.ReplaceAll(text, "\r\n", "\n"))
+}
+
+func escapeText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// normalizeWhitespace leaves single spaces, no spaces around line breaks and at most one blank line
+func normalizeWhitespace(text string) string {
+	text = spacesPattern.ReplaceAllString(strings.ReplaceAll(text, "\r", "\n"), " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// redactContacts replaces the emails and phone numbers, returning how many went
+// A bare run of digits is a reference, a price or a licence: a phone has the country code or is grouped like one
+func redactContacts(text string) (string, int) {
+	count := 0
+	for _, pattern := range []*regexp.Regexp{emailPattern, internationalPhone, portuguesePhone} {
+		text = pattern.ReplaceAllStringFunc(text, func(string) string {
+			count++
+			return CONTACT_PLACEHOLDER
+		})
+	}
+	return text, count
+}
+
+// visibleLength counts the characters a reader sees, tags left out on HTML
+func visibleLength(text string, isHTML bool) int {
+	if isHTML {
+		text = html.UnescapeString(tagPattern.ReplaceAllString(text, ""))
+	}
+	return utf8.RuneCountInString(text)
+}
+
+// truncateAtWord cuts the text on the last space that fits maxLength with the mark, closing the open tags on HTML
+func truncateAtWord(text string, maxLength int, isHTML bool) (string, bool) {
+	if maxLength <= 0 || visibleLength(text, isHTML) <= maxLength {
+		return text, false
+	}
+	limit := maxLength - utf8.RuneCountInString(TRUNCATION_MARK)
+
+	visible := 0
+	cut := 0
+	lastBreak := -1
+	for index := 0; index < len(text); {
+		// Tags and entities are skipped whole: never cut inside them
+		if isHTML && text[index] == '<' {
+			if end := strings.IndexByte(text[index:], '>'); end >= 0 {
+				index += end + 1
+				continue
+			}
+		}
+		size := 1
+		if isHTML && text[index] == '&' {
+			if end := strings.IndexByte(text[index:], ';'); end > 0 && end < 10 {
+				size = end + 1
+			}
+		}
+		r, runeSize := utf8.DecodeRuneInString(text[index:])
+		if size == 1 {
+			size = runeSize
+		}
+
+		if visible >= limit {
+			break
+		}
+		if unicode.IsSpace(r) {
+			lastBreak = index
+		}
+		visible++
+		index += size
+		cut = index
+	}
+
+	// A single word longer than the limit is cut where it is
+	if lastBreak > 0 {
+		cut = lastBreak
+	}
+	truncated := strings.TrimRightFunc(text[:cut], func(r rune) bool { return unicode.IsSpace(r) || strings.ContainsRune(",;:-", r) }) + TRUNCATION_MARK
+
+	if isHTML {
+		var open []string
+		for _, match := range tagPattern.FindAllStringSubmatch(truncated, -1) {
+			name := strings.ToLower(match[2])
+			if voidTags[name] {
+				continue
+			}
+			if match[1] == "/" {
+				if len(open) > 0 && open[len(open)-1] == name {
+					open = open[:len(open)-1]
+				}
+				continue
+			}
+			open = append(open, name)
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			truncated += "</" + open[i] + ">"
+		}
+	}
+	return truncated, true
+}
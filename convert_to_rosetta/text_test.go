@@ -0,0 +1,71 @@
+package convert_to_rosetta
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanDescription(t *testing.T) {
+	defer func(rules TextRules) { Text = rules }(Text)
+
+	tests := []struct {
+		format    string
+		raw       string
+		cleaned   string
+		redacted  int
+		maxLength int
+		wantCut   bool
+	}{
+		// Allowlisted tags stay without attributes, the rest go
+		{TEXT_FORMAT_HTML, `<p style="color:red">Moradia <b>V3</b> com <span class="x">jardim</span></p><script>track()</script>`, "<p>Moradia <b>V3</b> com jardim</p>", 0, 0, false},
+		{TEXT_FORMAT_HTML, "&lt;p&gt;Escapado pelo CRM&lt;/p&gt;", "<p>Escapado pelo CRM</p>", 0, 0, false},
+		{TEXT_FORMAT_HTML, "<b>Aberto<i> e fechado</b> no fim", "<b>Aberto<i> e fechado</i></b> no fim", 0, 0, false},
+		{TEXT_FORMAT_HTML, "Preço < 100 000 &amp; T2", "Preço &lt; 100 000 &amp; T2", 0, 0, false},
+
+		// Plain text: block tags are line breaks, entities decoded, whitespace tidied
+		{TEXT_FORMAT_PLAIN, "<p>Sala&nbsp;ampla</p><p></p><p></p><ul><li>Garagem</li><li>Jardim</li></ul>", "Sala ampla\n\n- Garagem\n- Jardim", 0, 0, false},
+		{TEXT_FORMAT_PLAIN, "  Linha   um \r\n\r\n\r\n\r\n  linha​ dois  ", "Linha um\n\nlinha dois", 0, 0, false},
+
+		// Contacts
+		{TEXT_FORMAT_PLAIN, "Ligue 912 345 678 ou +351 220-000-000 ou escreva para info@casas.pt", "Ligue [contacto removido] ou [contacto removido] ou escreva para [contacto removido]", 3, 0, false},
+		{TEXT_FORMAT_PLAIN, "Preço 250 000 €, 120 m2, ano 1998, ref. 123456789X", "Preço 250 000 €, 120 m2, ano 1998, ref. 123456789X", 0, 0, false},
+		{TEXT_FORMAT_PLAIN, "Tel. 00351912345678, 0044 20 7946 0958 ou +34 612 345 678", "Tel. [contacto removido], [contacto removido] ou [contacto removido]", 3, 0, false},
+		{TEXT_FORMAT_PLAIN, "Ref. 912345678, preço 250000000, licença 212345678, processo 0044123456789", "Ref. 912345678, preço 250000000, licença 212345678, processo 0044123456789", 0, 0, false},
+
+		// Cut at a word boundary, open tags closed
+		{TEXT_FORMAT_PLAIN, "Apartamento com vista mar e varanda", "Apartamento com vista…", 0, 25, true},
+		{TEXT_FORMAT_HTML, "<p>Apartamento <b>com vista mar</b> e varanda</p>", "<p>Apartamento <b>com vista…</b></p>", 0, 25, true},
+	}
+
+	for _, test := range tests {
+		Text.DescriptionFormat = test.format
+		Text.MaxDescriptionLength = test.maxLength
+		cleaned, changes := CleanDescription(test.raw)
+		if cleaned != test.cleaned || changes.Redacted != test.redacted || changes.Truncated != test.wantCut {
+			t.Errorf("CleanDescription(%q) = %q, %+v, want %q, %d redacted, cut %v", test.raw, cleaned, changes, test.cleaned, test.redacted, test.wantCut)
+		}
+		if test.maxLength > 0 && visibleLength(cleaned, test.format == TEXT_FORMAT_HTML) > test.maxLength {
+			t.Errorf("CleanDescription(%q) = %q is over %d characters", test.raw, cleaned, test.maxLength)
+		}
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	defer func(rules TextRules) { Text = rules }(Text)
+
+	// No limit by default, the portal does not document one
+	long := "Moradia V4 com piscina, garagem, jardim, churrasqueira e vista desafogada sobre o rio Douro"
+	if title, changes := CleanTitle(long); title != long || changes.Truncated {
+		t.Errorf("CleanTitle = %q, %+v, want the title whole", title, changes)
+	}
+
+	Text.MaxTitleLength = 70
+	title, changes := CleanTitle("<b>Moradia</b>\n  V4 com piscina, garagem, jardim, churrasqueira e vista desafogada sobre o rio Douro")
+	if strings.ContainsAny(title, "<>\n") || !changes.Truncated || utf8.RuneCountInString(title) > Text.MaxTitleLength || !strings.HasSuffix(title, "Douro") && !strings.HasSuffix(title, TRUNCATION_MARK) {
+		t.Errorf("CleanTitle = %q, %+v", title, changes)
+	}
+	if title != "Moradia V4 com piscina, garagem, jardim, churrasqueira e vista…" {
+		t.Errorf("CleanTitle = %q, want the cut after \"vista\"", title)
+	}
+}
@@ -0,0 +1,128 @@
+package convert_to_rosetta
+
+import (
+	"go-test/report"
+	"go-test/validation"
+)
+
+// Codes of the legal field issues
+const (
+	ISSUE_INVALID_NIF         = "invalid_nif"
+	ISSUE_INVALID_AMI         = "invalid_ami"
+	ISSUE_INVALID_POSTAL_CODE = "invalid_postal_code"
+	ISSUE_UNKNOWN_POSTAL_CODE = "unknown_postal_code"
+	ISSUE_INVALID_LICENCE     = "invalid_user_license"
+)
+
+// Codes of the energy certificate issues
+const (
+	ISSUE_ENERGY_CERTIFICATE_IN_PROGRESS = "energy_certificate_in_progress"
+	ISSUE_UNKNOWN_ENERGY_CERTIFICATE     = "unknown_energy_certificate"
+)
+
+// Codes of the mapping issues
+const (
+	ISSUE_INVALID_PRICE      = "invalid_price"
+	ISSUE_UNMAPPED_ATTRIBUTE = "unmapped_attribute_value"
+	ISSUE_CATEGORY_INFERRED  = "category_inferred"
+	ISSUE_CATEGORY_UNCERTAIN = "category_low_confidence"
+	ISSUE_UNKNOWN_OFFER_TYPE = "unknown_offer_type"
+)
+
+// Codes of the image issues
+const (
+	ISSUE_INVALID_IMAGE_URL = "invalid_image_url"
+	ISSUE_DUPLICATE_IMAGE   = "duplicate_image"
+	ISSUE_TOO_MANY_IMAGES   = "too_many_images"
+	ISSUE_BROKEN_IMAGE      = "broken_image"
+	ISSUE_NOT_AN_IMAGE      = "not_an_image"
+	ISSUE_MIRROR_FAILED     = "image_mirror_failed"
+)
+
+// Codes of the video and virtual tour issues
+const (
+	ISSUE_UNSUPPORTED_VIDEO = "unsupported_video_host"
+	ISSUE_INVALID_VIDEO     = "invalid_video_url"
+	ISSUE_TOUR_LEFT_OUT     = "virtual_tour_left_out"
+)
+
+// Codes of the title and description issues
+const (
+	ISSUE_TEXT_TRUNCATED   = "text_truncated"
+	ISSUE_CONTACT_REDACTED = "contact_redacted"
+)
+
+// Codes of the language issues
+const (
+	ISSUE_LANGUAGE_DETECTED  = "language_detected"
+	ISSUE_NO_PORTUGUESE_TEXT = "no_portuguese_text"
+	ISSUE_INVALID_LANGUAGE   = "invalid_language"
+)
+
+// Codes of the consultant issues
+const (
+	ISSUE_UNKNOWN_CONSULTANT       = "unknown_consultant"
+	ISSUE_INVALID_CONSULTANT       = "invalid_consultant"
+	ISSUE_DUPLICATE_CONSULTANT     = "duplicate_consultant"
+	ISSUE_INVALID_PHONE            = "invalid_phone"
+	ISSUE_INVALID_CONSULTANT_PHOTO = "invalid_consultant_photo"
+)
+
+// ValidateAgencyLegalFields checks the AMI licence and the NIF of the agency
+func ValidateAgencyLegalFields(fullData map[string]interface{}) []report.Issue {
+	var issues []report.Issue
+
+	userMap, userExists := fullData["User"].(map[string]interface{})
+	if !userExists {
+		return issues
+	}
+
+	// AMI is mandatory on real estate ads
+	ami, _ := userMap["Ami"].(string)
+	if !validation.ValidAMI(ami) {
+		issues = append(issues, report.Issue{Level: report.LEVEL_ERROR, Code: ISSUE_INVALID_AMI, Message: "AMI licence number is missing or malformed", Field: "ami", Value: ami})
+	}
+
+	taxID, _ := userMap["TaxID"].(string)
+	if taxID != "" && !validation.ValidNIF(taxID) {
+		issues = append(issues, report.Issue{Level: report.LEVEL_ERROR, Code: ISSUE_INVALID_NIF, Message: "NIF check digit does not match", Field: "taxid", Value: taxID})
+	}
+
+	return issues
+}
+
+// ValidateAdvertLegalFields checks the postal code and the user licence of one advert
+func ValidateAdvertLegalFields(advert map[string]interface{}) []report.Issue {
+	var issues []report.Issue
+	externalId, _ := advert["ExternalID"].(string)
+
+	if postalCode, _ := advert["PostalCode"].(string); postalCode != "" {
+		normalized := validation.NormalizePostalCode(postalCode)
+		if normalized == "" {
+			issues = append(issues, report.Issue{Level: report.LEVEL_ERROR, Code: ISSUE_INVALID_POSTAL_CODE, Message: "Postal code is not in the NNNN-NNN format", Field: "postal_code", Value: postalCode, ExternalID: externalId})
+		} else if !validation.PostalCodeExists(normalized) {
+			// The bundled CP4 ranges are coarse: a miss there is not enough to reject the advert
+			if validation.HasFullPostalCodes() {
+				issues = append(issues, report.Issue{Level: report.LEVEL_ERROR, Code: ISSUE_UNKNOWN_POSTAL_CODE, Message: "Postal code does not exist", Field: "postal_code", Value: postalCode, ExternalID: externalId})
+			} else {
+				issues = append(issues, report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_UNKNOWN_POSTAL_CODE, Message: "Postal code is outside the known CP4 ranges", Field: "postal_code", Value: postalCode, ExternalID: externalId})
+			}
+		}
+	}
+
+	if licence, _ := advert["NumOfUserLicence"].(string); licence != "" && !validation.ValidUserLicence(licence) {
+		issues = append(issues, report.Issue{Level: report.LEVEL_ERROR, Code: ISSUE_INVALID_LICENCE, Message: "User licence must be 'Isento' or a licence number", Field: "number_of_user_license", Value: licence, ExternalID: externalId})
+	}
+
+	return issues
+}
+
+// hasErrors tells if any issue is an error, the only ones strict mode rejects on
+func hasErrors(issues []report.Issue) bool {
+	for _, issue := range issues {
+		if issue.Level == report.LEVEL_ERROR {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package convert_to_rosetta
+
+import (
+	"go-test/report"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestStrictValidationRejectsOnErrors(t *testing.T) {
+	advert := func(externalID string, postalCode string) map[string]interface{} {
+		return map[string]interface{}{"ExternalID": externalID, "PostalCode": postalCode, "OfferType": "Venda", "Category": "Moradias", "Title": "Moradia T3"}
+	}
+	fullData := map[string]interface{}{
+		"User": map[string]interface{}{"Email": "geral@casasdominho.pt", "Ami": "AMI 9021"},
+		"Adverts": []interface{}{
+			advert("valid", "4700-320"),
+			advert("outside-cp4", "5600-123"), // only a warning with the bundled CP4 ranges
+			advert("malformed", "56001"),
+		},
+	}
+
+	conversionReport := report.New()
+	rosettaXML, err := ConvertJSONToRosetta(fullData, Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil)), Report: conversionReport, StrictValidation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conversionReport.RejectedAdverts) != 1 || conversionReport.RejectedAdverts[0] != "malformed" {
+		t.Errorf("rejected = %v, want only the malformed postal code", conversionReport.RejectedAdverts)
+	}
+	if count := strings.Count(rosettaXML, "<advert>"); count != 2 {
+		t.Errorf("published %d adverts, want 2", count)
+	}
+	warned := false
+	for _, issue := range conversionReport.Issues {
+		warned = warned || (issue.Code == ISSUE_UNKNOWN_POSTAL_CODE && issue.Level == report.LEVEL_WARNING && issue.ExternalID == "outside-cp4")
+	}
+	if !warned {
+		t.Errorf("issues = %+v, want the CP4 warning on the published advert", conversionReport.Issues)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-test/convert_to_rosetta"
+	"go-test/report"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// runDryRunCommand handles `dry-run [-strict] [-preview n] <feed>`: converts a local feed and prints the report, nothing is written
+func runDryRunCommand(args []string) int {
+	strict := serverConfig.StrictValidation
+	previewAdverts := serverConfig.DryRunPreview
+	for len(args) > 1 {
+		if args[0] == "-strict" {
+			strict = true
+			args = args[1:]
+		} else if args[0] == "-preview" && len(args) > 2 {
+			preview, err := strconv.Atoi(args[1])
+			if err != nil || preview < 0 {
+				fmt.Println("Invalid preview count:", args[1])
+				return 2
+			}
+			previewAdverts = preview
+			args = args[2:]
+		} else {
+			break
+		}
+	}
+
+	if len(args) != 1 {
+		fmt.Println("Usage: dry-run [-strict] [-preview <n>] <feed.xml|feed.xml.gz>")
+		return 2
+	}
+
+	if err := loadMappingData(serverConfig); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Println("Error reading feed:", err)
+		return 1
+	}
+
+	// Gzipped feeds go through the same limits as the uploads
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		decompressed, decompressError := readDecompressed(content, serverConfig)
+		if decompressError != nil {
+			fmt.Println("Error decompressing feed:", decompressError.Message)
+			return 1
+		}
+		content = decompressed
+	}
+
+	conversionReport := report.New()
+	result, err := parseFeed(content, conversionReport)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// Mapping messages would get mixed with the report, the report already has them
+	_, err = convert_to_rosetta.ConvertJSONToRosetta(result, convert_to_rosetta.Options{
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Report:           conversionReport,
+		StrictValidation: strict,
+		Pretty:           true,
+		DryRun:           true,
+		PreviewAdverts:   previewAdverts,
+		ImageClient:      imageClient,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(conversionReport); err != nil {
+		fmt.Println("Error writing report:", err)
+		return 1
+	}
+
+	// Exit code tells scripts if the feed has errors
+	for _, issue := range conversionReport.Issues {
+		if issue.Level == report.LEVEL_ERROR {
+			return 3
+		}
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes returned to the clients together with the HTTP status
+const (
+	ERR_UPLOAD_TOO_LARGE       = "upload_too_large"
+	ERR_DECOMPRESSED_TOO_LARGE = "decompressed_too_large"
+	ERR_COMPRESSION_RATIO      = "compression_ratio_exceeded"
+	ERR_INVALID_GZIP           = "gzip_error"
+	ERR_XML_TOO_COMPLEX        = "xml_too_complex"
+	ERR_UNAUTHORIZED           = "unauthorized"
+	ERR_OWNER_NOT_ALLOWED      = "owner_not_allowed"
+	ERR_INVALID_OWNER          = "invalid_owner_email"
+	ERR_RATE_LIMITED           = "rate_limited"
+	ERR_SERVER_BUSY            = "server_busy"
+	ERR_NOT_FOUND              = "not_found"
+	ERR_ADMIN_REQUIRED         = "admin_required"
+	ERR_INVALID_REQUEST        = "invalid_request"
+	ERR_WRITE_FAILED           = "write_failed"
+)
+
+// apiError is a failure with its own status and machine readable code
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// writeError sends the error as JSON with its HTTP status
+func writeError(w http.ResponseWriter, err *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(err)
+}
+
+// writeRetryError sends the error with a Retry-After header rounded up to whole seconds
+func writeRetryError(w http.ResponseWriter, err *apiError, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, err)
+}
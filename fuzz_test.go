@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"go-test/convert_to_json"
+	"go-test/convert_to_rosetta"
+	"go-test/report"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzConversionPipeline feeds arbitrary bytes through both conversions: no panics and well formed XML out
+func FuzzConversionPipeline(f *testing.F) {
+	feeds, _ := filepath.Glob(filepath.Join("testdata", "feeds", "*.xml"))
+	for _, feed := range feeds {
+		if content, err := os.ReadFile(feed); err == nil {
+			f.Add(content)
+		}
+	}
+	f.Add([]byte("<data></data>"))
+	f.Add([]byte("<data><advert><title>]]></title></advert></data>"))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		conversionReport := report.New()
+		jsonData, err := convert_to_json.ConvertXMLToJSON(content, conversionReport)
+		if err != nil {
+			return
+		}
+
+		var result map[string]interface{}
+		if err := json.Unmarshal(jsonData, &result); err != nil {
+			t.Fatalf("ConvertXMLToJSON produced invalid JSON: %v", err)
+		}
+
+		for _, pretty := range []bool{false, true} {
+			rosettaXML, err := convert_to_rosetta.ConvertJSONToRosetta(result, convert_to_rosetta.Options{Logger: logger, Report: conversionReport, Pretty: pretty})
+			if err != nil {
+				return
+			}
+			assertWellFormed(t, rosettaXML)
+		}
+	})
+}
+
+func assertWellFormed(t *testing.T, document string) {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader([]byte(document)))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("output is not well formed XML: %v\n%s", err, document)
+		}
+	}
+}
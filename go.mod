@@ -2,6 +2,4 @@ module go-test
 
 go 1.21.5
 
-require (
-	golang.org/x/text v0.14.0 // indirect
-)
+require golang.org/x/text v0.14.0
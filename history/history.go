@@ -0,0 +1,292 @@
+package history
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-test/report"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Files kept for every conversion
+const (
+	FILE_INPUT  = "input"
+	FILE_OUTPUT = "output"
+	FILE_REPORT = "report"
+)
+
+var fileNames = map[string]string{
+	FILE_INPUT:  "input.xml.gz",
+	FILE_OUTPUT: "output.xml",
+	FILE_REPORT: "report.json",
+}
+
+// Same code as convert_to_rosetta.ISSUE_UNMAPPED_ATTRIBUTE, counted apart on every entry
+const ISSUE_UNMAPPED_ATTRIBUTE = "unmapped_attribute_value"
+
+var ErrNotFound = errors.New("conversion not found")
+
+// Entry sums up one conversion; the files themselves stay next to it on disk
+type Entry struct {
+	ID           string    `json:"id"`
+	Owner        string    `json:"owner"`
+	CreatedAt    time.Time `json:"created_at"`
+	DryRun       bool      `json:"dry_run"`
+	Adverts      int       `json:"adverts"`
+	Rejected     int       `json:"rejected"`
+	Errors       int       `json:"errors"`
+	Warnings     int       `json:"warnings"`
+	Unmapped     int       `json:"unmapped"`
+	OutputSHA256 string    `json:"output_sha256,omitempty"`
+	InputBytes   int       `json:"input_bytes"`
+	OutputBytes  int       `json:"output_bytes"`
+}
+
+// Store keeps the last conversions of every owner under <dir>/<owner hash>/<id>/
+type Store struct {
+	dir  string
+	keep int
+	mu   sync.Mutex
+}
+
+// NewStore creates the history directory; keep is how many conversions are kept per owner
+func NewStore(dir string, keep int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating history directory: %v", err)
+	}
+	return &Store{dir: dir, keep: keep}, nil
+}
+
+// Record saves the uploaded file, the output and the report, dropping the oldest conversions over the limit
+func (s *Store) Record(owner string, input []byte, output string, conversionReport *report.Report) (Entry, error) {
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(idBytes); err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{
+		ID:           time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(idBytes),
+		Owner:        owner,
+		CreatedAt:    time.Now().UTC(),
+		DryRun:       conversionReport.DryRun,
+		Adverts:      conversionReport.AdvertCount,
+		Rejected:     len(conversionReport.RejectedAdverts),
+		OutputSHA256: conversionReport.OutputSHA256,
+		InputBytes:   len(input),
+		OutputBytes:  len(output),
+	}
+	for _, issue := range conversionReport.Issues {
+		switch issue.Level {
+		case report.LEVEL_ERROR:
+			entry.Errors++
+		case report.LEVEL_WARNING:
+			entry.Warnings++
+		}
+		if issue.Code == ISSUE_UNMAPPED_ATTRIBUTE {
+			entry.Unmapped++
+		}
+	}
+
+	conversionReport.ConversionID = entry.ID
+	conversionReport.Owner = owner
+	reportContent, err := json.MarshalIndent(conversionReport, "", "  ")
+	if err != nil {
+		return Entry{}, err
+	}
+	entryContent, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return Entry{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversionDir := filepath.Join(s.ownerDir(owner), entry.ID)
+	if err := os.MkdirAll(conversionDir, 0755); err != nil {
+		return Entry{}, err
+	}
+	files := map[string][]byte{
+		fileNames[FILE_INPUT]:  input,
+		fileNames[FILE_OUTPUT]: []byte(output),
+		fileNames[FILE_REPORT]: reportContent,
+		"entry.json":           entryContent,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(conversionDir, name), content, 0644); err != nil {
+			return Entry{}, fmt.Errorf("Error writing history file: %v", err)
+		}
+	}
+
+	s.prune(owner)
+	return entry, nil
+}
+
+// List returns the conversions of the owner, newest first
+func (s *Store) List(owner string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(s.ownerDir(owner))
+}
+
+// ListAll returns the conversions of every owner, newest first
+func (s *Store) ListAll() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ownerDirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, ownerDir := range ownerDirs {
+		if !ownerDir.IsDir() {
+			continue
+		}
+		ownerEntries, err := s.list(filepath.Join(s.dir, ownerDir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ownerEntries...)
+	}
+	SortNewestFirst(entries)
+	return entries, nil
+}
+
+// Latest returns the newest conversion of every owner, dry runs included or not
+func (s *Store) Latest(includeDryRuns bool) ([]Entry, error) {
+	entries, err := s.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	latest := []Entry{}
+	for _, entry := range entries {
+		owner := strings.ToLower(entry.Owner)
+		if seen[owner] || (entry.DryRun && !includeDryRuns) {
+			continue
+		}
+		seen[owner] = true
+		latest = append(latest, entry)
+	}
+	return latest, nil
+}
+
+// Get finds one conversion of the owner
+func (s *Store) Get(owner string, id string) (Entry, error) {
+	if !validID(id) {
+		return Entry{}, ErrNotFound
+	}
+	content, err := os.ReadFile(filepath.Join(s.ownerDir(owner), id, "entry.json"))
+	if err != nil {
+		return Entry{}, ErrNotFound
+	}
+	var entry Entry
+	if err := json.Unmarshal(content, &entry); err != nil {
+		return Entry{}, fmt.Errorf("Error reading history entry: %v", err)
+	}
+	return entry, nil
+}
+
+// FilePath gives the path of the input, output or report of a conversion
+func (s *Store) FilePath(owner string, id string, kind string) (string, error) {
+	name, known := fileNames[kind]
+	if !known || !validID(id) {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(s.ownerDir(owner), id, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// FileName is the name offered for download ("input.xml.gz"...)
+func FileName(kind string) string {
+	return fileNames[kind]
+}
+
+// SortNewestFirst orders the entries, of one owner or several, going by the creation time: the ID only has seconds, and a random part after them
+func SortNewestFirst(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+}
+
+//------------------------------------------------------------------- Helpers
+
+// ownerDir hashes the email so no owner can escape the history directory
+func (s *Store) ownerDir(owner string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(owner))))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:8]))
+}
+
+func (s *Store) list(ownerDir string) ([]Entry, error) {
+	conversionDirs, err := os.ReadDir(ownerDir)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, conversionDir := range conversionDirs {
+		content, err := os.ReadFile(filepath.Join(ownerDir, conversionDir.Name(), "entry.json"))
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(content, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	SortNewestFirst(entries)
+	return entries, nil
+}
+
+// prune removes the oldest conversions over the limit; callers hold the lock.
+// The newest published one always stays, whatever the dry runs after it: reconversions start from it.
+func (s *Store) prune(owner string) {
+	if s.keep <= 0 {
+		return
+	}
+	entries, err := s.list(s.ownerDir(owner))
+	if err != nil {
+		return
+	}
+
+	publishedKept := false
+	for i, entry := range entries {
+		if i < s.keep || (!entry.DryRun && !publishedKept) {
+			publishedKept = publishedKept || !entry.DryRun
+			continue
+		}
+		os.RemoveAll(filepath.Join(s.ownerDir(owner), entry.ID))
+	}
+}
+
+// validID accepts only the IDs Record creates, nothing that could walk the file system
+func validID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r == 'T' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
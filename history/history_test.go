@@ -0,0 +1,179 @@
+package history
+
+import (
+	"errors"
+	"go-test/report"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record saves a conversion with one error and one unmapped warning
+func record(t *testing.T, store *Store, owner string, dryRun bool) Entry {
+	t.Helper()
+	conversionReport := report.New()
+	conversionReport.DryRun = dryRun
+	conversionReport.AdvertCount = 2
+	conversionReport.Add(report.Issue{Level: report.LEVEL_ERROR, Code: "invalid_postal_code"})
+	conversionReport.Add(report.Issue{Level: report.LEVEL_WARNING, Code: ISSUE_UNMAPPED_ATTRIBUTE})
+
+	entry, err := store.Record(owner, []byte("gzip"), "<data/>", conversionReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestRecordAndList(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := record(t, store, "geral@arhome.pt", false)
+	second := record(t, store, "Geral@ARHome.pt", true)
+	record(t, store, "outra@agencia.pt", false)
+
+	if first.Adverts != 2 || first.Errors != 1 || first.Warnings != 1 || first.Unmapped != 1 || first.InputBytes != 4 || first.OutputBytes != 7 {
+		t.Errorf("entry = %+v, want the counts of the report", first)
+	}
+
+	// The owner email is case insensitive, the newest conversion comes first
+	entries, err := store.List("GERAL@arhome.pt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != second.ID || entries[1].ID != first.ID {
+		t.Errorf("List = %+v, want the two conversions newest first", entries)
+	}
+
+	got, err := store.Get("geral@arhome.pt", first.ID)
+	if err != nil || got.ID != first.ID {
+		t.Errorf("Get = %+v, %v, want the first conversion", got, err)
+	}
+	for _, kind := range []string{FILE_INPUT, FILE_OUTPUT, FILE_REPORT} {
+		if _, err := store.FilePath("geral@arhome.pt", first.ID, kind); err != nil {
+			t.Errorf("FilePath(%s) = %v", kind, err)
+		}
+	}
+
+	// Another owner does not see those conversions
+	if _, err := store.Get("outra@agencia.pt", first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get from another owner = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	store, _ := NewStore(t.TempDir(), 10)
+	published := record(t, store, "geral@arhome.pt", false)
+	dryRun := record(t, store, "geral@arhome.pt", true)
+	other := record(t, store, "outra@agencia.pt", false)
+
+	latest, err := store.Latest(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 2 || latest[0].ID != other.ID || latest[1].ID != published.ID {
+		t.Errorf("Latest(false) = %+v, want the newest published conversion of each owner", latest)
+	}
+
+	latest, _ = store.Latest(true)
+	if len(latest) != 2 || latest[1].ID != dryRun.ID {
+		t.Errorf("Latest(true) = %+v, want the dry run as the newest of its owner", latest)
+	}
+}
+
+func TestKeepLimit(t *testing.T) {
+	store, _ := NewStore(t.TempDir(), 3)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, record(t, store, "geral@arhome.pt", false).ID)
+	}
+
+	entries, _ := store.List("geral@arhome.pt")
+	if len(entries) != 3 {
+		t.Fatalf("%d conversions kept, want 3", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.ID != ids[4-i] {
+			t.Errorf("entry %d = %s, want %s: the oldest ones must go", i, entry.ID, ids[4-i])
+		}
+	}
+	if _, err := store.Get("geral@arhome.pt", ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("pruned conversion still found: %v", err)
+	}
+}
+
+func TestKeepLimitKeepsPublished(t *testing.T) {
+	store, _ := NewStore(t.TempDir(), 3)
+	published := record(t, store, "geral@arhome.pt", false)
+	for i := 0; i < 5; i++ {
+		record(t, store, "geral@arhome.pt", true)
+	}
+
+	// The three newest dry runs and the published feed they came after
+	entries, _ := store.List("geral@arhome.pt")
+	if len(entries) != 4 || entries[3].ID != published.ID {
+		t.Fatalf("List = %+v, want 3 dry runs and the published conversion", entries)
+	}
+	latest, _ := store.Latest(false)
+	if len(latest) != 1 || latest[0].ID != published.ID {
+		t.Errorf("Latest(false) = %+v, want the published conversion", latest)
+	}
+
+	// Once a newer feed is published the old one can go
+	newer := record(t, store, "geral@arhome.pt", false)
+	entries, _ = store.List("geral@arhome.pt")
+	if len(entries) != 3 || entries[0].ID != newer.ID {
+		t.Errorf("List = %+v, want the 3 newest conversions", entries)
+	}
+}
+
+func TestSortNewestFirst(t *testing.T) {
+	// Same second on the ID, the random part says the opposite of the creation time
+	created := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{ID: "20260302T100000-ffffffff", Owner: "a@arhome.pt", CreatedAt: created},
+		{ID: "20260302T100000-00000000", Owner: "b@agencia.pt", CreatedAt: created.Add(300 * time.Millisecond)},
+	}
+
+	SortNewestFirst(entries)
+	if entries[0].Owner != "b@agencia.pt" {
+		t.Errorf("SortNewestFirst = %+v, want the later conversion first", entries)
+	}
+}
+
+func TestPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewStore(dir, 10)
+	entry := record(t, store, "geral@arhome.pt", false)
+
+	// IDs never leave the owner directory
+	for _, id := range []string{"../" + entry.ID, "..", entry.ID + "/../..", "", strings.Repeat("a", 65), "20240101T000000-ABCDEF01"} {
+		if _, err := store.FilePath("geral@arhome.pt", id, FILE_OUTPUT); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FilePath with id %q = %v, want ErrNotFound", id, err)
+		}
+		if _, err := store.Get("geral@arhome.pt", id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get with id %q = %v, want ErrNotFound", id, err)
+		}
+	}
+	if _, err := store.FilePath("geral@arhome.pt", entry.ID, "../entry.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FilePath with an unknown kind = %v, want ErrNotFound", err)
+	}
+
+	// Owners are hashed: "../" in the email stays inside the history directory
+	outside := filepath.Join(dir, "..", "escaped")
+	traversal := record(t, store, "../escaped", false)
+	path, err := store.FilePath("../escaped", traversal.ID, FILE_OUTPUT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel, err := filepath.Rel(dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		t.Errorf("owner '../escaped' wrote to %s, outside %s", path, dir)
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("%s was created", outside)
+	}
+}
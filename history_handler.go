@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"go-test/auth"
+	"go-test/history"
+	"go-test/logging"
+	"net/http"
+	"strings"
+)
+
+// historyHandler serves `GET /history[?owner=]` with the past conversions and `GET /history/<id>/<input|output|report>?owner=` with their files
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var apiKey *auth.APIKey
+	if serverConfig.AuthEnabled {
+		key, err := keyStore.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, &apiError{Status: http.StatusUnauthorized, Code: ERR_UNAUTHORIZED, Message: err.Error()})
+			return
+		}
+		apiKey = key
+	}
+
+	owner := r.URL.Query().Get("owner")
+	if owner != "" && apiKey != nil && !apiKey.Authorizes(owner) {
+		writeError(w, &apiError{Status: http.StatusForbidden, Code: ERR_OWNER_NOT_ALLOWED, Message: "API key is not allowed to see the conversions of '" + owner + "'"})
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/history"), "/")
+	if path == "" {
+		entries, err := listConversions(owner, apiKey)
+		if err != nil {
+			logger.Error("error listing conversions", "error", err)
+			http.Error(w, "Error listing conversions", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	// Files always belong to one owner
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || owner == "" {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: ERR_NOT_FOUND, Message: "Use /history/<id>/<input|output|report>?owner=<email>"})
+		return
+	}
+	filePath, err := conversionHistory.FilePath(owner, parts[0], parts[1])
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: ERR_NOT_FOUND, Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="`+parts[0]+"-"+history.FileName(parts[1])+`"`)
+	http.ServeFile(w, r, filePath)
+}
+
+// listConversions returns the history of one owner, of every owner of the key, or of everybody when auth is off
+func listConversions(owner string, apiKey *auth.APIKey) ([]history.Entry, error) {
+	if owner != "" {
+		return conversionHistory.List(owner)
+	}
+	if apiKey == nil {
+		return conversionHistory.ListAll()
+	}
+
+	entries := []history.Entry{}
+	for _, keyOwner := range apiKey.Owners {
+		ownerEntries, err := conversionHistory.List(keyOwner)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ownerEntries...)
+	}
+	history.SortNewestFirst(entries)
+	return entries, nil
+}
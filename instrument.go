@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"go-test/logging"
+	"go-test/metrics"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// statusRecorder remembers the status written by the handler, 0 while nothing was written
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write without WriteHeader is an implicit 200, like net/http sends it
+func (r *statusRecorder) Write(content []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(content)
+}
+
+// instrumentConversions counts every conversion request by outcome
+func instrumentConversions(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r)
+		metrics.Conversions.Inc(conversionOutcome(recorder.status))
+	}
+}
+
+// requireAdmin lets only admin keys through when auth is on, the metrics tell about every owner
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if serverConfig.AuthEnabled {
+			key, err := keyStore.Authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, &apiError{Status: http.StatusUnauthorized, Code: ERR_UNAUTHORIZED, Message: err.Error()})
+				return
+			}
+			if !key.Admin {
+				writeError(w, &apiError{Status: http.StatusForbidden, Code: ERR_ADMIN_REQUIRED, Message: "Only admin keys can read the metrics"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// conversionOutcome groups the HTTP statuses into a few outcomes for dashboards
+func conversionOutcome(status int) string {
+	switch status {
+	case http.StatusOK:
+		return "success"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "unauthorized"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable:
+		return "busy"
+	case http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusBadRequest:
+		return "rejected"
+	case http.StatusMethodNotAllowed:
+		return "bad_request"
+	case 0:
+		// The handler returned without answering, the client got an empty 200: not a success
+		return "no_response"
+	default:
+		return "error"
+	}
+}
+
+// withRequestLogger tags the request with an ID and stores a logger carrying it in the context
+func withRequestLogger(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 64 {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		logger := slog.Default().With("request_id", requestID)
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next(recorder, r.WithContext(logging.WithLogger(r.Context(), logger)))
+
+		// Nothing written is the empty 200 net/http sends
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		logger.Info("request", "method", r.Method, "path", r.URL.Path, "status", status, "duration", time.Since(start))
+	}
+}
+
+func newRequestID() string {
+	idBytes := make([]byte, 8)
+	rand.Read(idBytes)
+	return hex.EncodeToString(idBytes)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"go-test/history"
+	"go-test/metrics"
+	"go-test/ratelimit"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRequestLoggerStatus(t *testing.T) {
+	defer func(logger *slog.Logger) { slog.SetDefault(logger) }(slog.Default())
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  float64
+	}{
+		{"error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}, http.StatusMethodNotAllowed},
+		{"implicit 200", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }, http.StatusOK},
+		{"nothing written", func(w http.ResponseWriter, r *http.Request) {}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		var logged bytes.Buffer
+		slog.SetDefault(slog.New(slog.NewJSONHandler(&logged, nil)))
+
+		withRequestLogger(test.handler)(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/convert", nil))
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(logged.Bytes(), &record); err != nil {
+			t.Fatalf("%s: log %q is not one JSON record: %v", test.name, logged.String(), err)
+		}
+		if record["status"] != test.status {
+			t.Errorf("%s: logged status = %v, want %v", test.name, record["status"], test.status)
+		}
+	}
+}
+
+func TestMetricsCountPublishedAdverts(t *testing.T) {
+	defer func(config Config) { serverConfig = config }(serverConfig)
+	defer func(logger *slog.Logger) { slog.SetDefault(logger) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	serverConfig.AuthEnabled = false
+	serverConfig.StrictValidation = false
+
+	tiers, err := ratelimit.ParseTiers(serverConfig.RateTiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimiter = ratelimit.NewLimiter(tiers)
+	conversionGate = ratelimit.NewGate(1, 1, serverConfig.QueueTimeout)
+	if conversionHistory, err = history.NewStore(t.TempDir(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// converted/ is relative to the working directory
+	feed, err := os.ReadFile(filepath.Join("testdata", "feeds", "offer_types.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownCategories, err := os.ReadFile(filepath.Join("testdata", "feeds", "unknown_category.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	workingDir, _ := os.Getwd()
+	defer os.Chdir(workingDir)
+	os.Chdir(t.TempDir())
+	os.Mkdir("converted", 0755)
+
+	handler := withRequestLogger(instrumentConversions(xmlHandler))
+	adverts, misses := scrapeMetric(t, "xmlconv_adverts_converted_total"), scrapeMetric(t, "xmlconv_category_mapping_misses_total")
+
+	// A dry run publishes nothing
+	for _, content := range [][]byte{feed, unknownCategories} {
+		if status := postFeed(handler, "/convert?dry_run=true", content); status != http.StatusOK {
+			t.Fatalf("dry run answered %d", status)
+		}
+	}
+	if got := scrapeMetric(t, "xmlconv_adverts_converted_total"); got != adverts {
+		t.Errorf("adverts converted after a dry run = %v, want %v", got, adverts)
+	}
+	if got := scrapeMetric(t, "xmlconv_category_mapping_misses_total"); got != misses {
+		t.Errorf("category misses after a dry run = %v, want %v", got, misses)
+	}
+
+	// 4 adverts, the Permuta one is rejected
+	if status := postFeed(handler, "/convert", feed); status != http.StatusOK {
+		t.Fatalf("conversion answered %d", status)
+	}
+	if got := scrapeMetric(t, "xmlconv_adverts_converted_total"); got != adverts+3 {
+		t.Errorf("adverts converted = %v, want %v", got, adverts+3)
+	}
+
+	// Vivendas and Outros are not on the category table
+	if status := postFeed(handler, "/convert", unknownCategories); status != http.StatusOK {
+		t.Fatalf("conversion answered %d", status)
+	}
+	if got := scrapeMetric(t, "xmlconv_category_mapping_misses_total"); got != misses+2 {
+		t.Errorf("category misses = %v, want %v", got, misses+2)
+	}
+}
+
+func postFeed(handler http.HandlerFunc, target string, feed []byte) int {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "feed.xml.gz")
+	compressor := gzip.NewWriter(part)
+	compressor.Write(feed)
+	compressor.Close()
+	form.Close()
+
+	request := httptest.NewRequest(http.MethodPost, target, &body)
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	return recorder.Code
+}
+
+// scrapeMetric reads /metrics and sums the samples of the metric over every label set
+func scrapeMetric(t *testing.T, name string) float64 {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	requireAdmin(metrics.Handler()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("/metrics answered %d", recorder.Code)
+	}
+
+	total := 0.0
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if !strings.HasPrefix(line, name+" ") && !strings.HasPrefix(line, name+"{") {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[strings.LastIndex(line, " ")+1:], 64)
+		if err != nil {
+			t.Fatalf("sample %q: %v", line, err)
+		}
+		total += value
+	}
+	return total
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"go-test/auth"
+	"os"
+	"strings"
+)
+
+// runKeysCommand handles `keys issue|revoke|list` so keys can be managed without the server
+func runKeysCommand(args []string) int {
+	store, err := auth.NewStore(serverConfig.KeysFile)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if len(args) == 0 {
+		fmt.Println("Usage: keys issue [-tier <name>] [-admin] <owner_email>... | keys revoke <key_id> | keys list")
+		return 2
+	}
+
+	switch args[0] {
+	case "issue":
+		owners := args[1:]
+		tier := ""
+		admin := false
+		for len(owners) > 0 && strings.HasPrefix(owners[0], "-") {
+			if owners[0] == "-admin" {
+				admin = true
+				owners = owners[1:]
+			} else if owners[0] == "-tier" && len(owners) >= 2 {
+				tier = owners[1]
+				owners = owners[2:]
+			} else {
+				break
+			}
+		}
+		secret, key, err := store.Issue(owners, tier, admin)
+		if err != nil {
+			fmt.Println("Error issuing key:", err)
+			return 1
+		}
+		fmt.Println("Key ID:", key.ID)
+		fmt.Println("Owners:", strings.Join(key.Owners, ", "))
+		if key.Tier != "" {
+			fmt.Println("Tier:", key.Tier)
+		}
+		if key.Admin {
+			fmt.Println("Admin: yes")
+		}
+		fmt.Println("Secret (shown only once):", secret)
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Println("Usage: keys revoke <key_id>")
+			return 2
+		}
+		if err := store.Revoke(args[1]); err != nil {
+			fmt.Println("Error revoking key:", err)
+			return 1
+		}
+		fmt.Println("Key revoked:", args[1])
+	case "list":
+		for _, key := range store.List() {
+			status := "active"
+			if key.Revoked {
+				status = "revoked"
+			}
+			tier := key.Tier
+			if tier == "" {
+				tier = "default"
+			}
+			if key.Admin {
+				status += ",admin"
+			}
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\t%s\n", key.ID, status, tier, key.CreatedAt.Format("2006-01-02"), strings.Join(key.Owners, ","))
+		}
+	default:
+		fmt.Println("Unknown keys command: " + args[0])
+		return 2
+	}
+	return 0
+}
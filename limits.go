@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// readDecompressed inflates the gzip upload enforcing the size and ratio limits
+func readDecompressed(compressedContent []byte, config Config) ([]byte, *apiError) {
+	reader, err := gzip.NewReader(bytes.NewReader(compressedContent))
+	if err != nil {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: ERR_INVALID_GZIP, Message: "Upload is not valid Gzip"}
+	}
+	defer reader.Close()
+
+	// Stop reading as soon as the lowest of both limits is crossed
+	maxByRatio := int64(len(compressedContent)) * config.MaxCompressionRatio
+	limit := config.MaxDecompressedBytes
+	if maxByRatio < limit {
+		limit = maxByRatio
+	}
+
+	decompressedContent, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, &apiError{Status: http.StatusBadRequest, Code: ERR_INVALID_GZIP, Message: "Gzip upload is corrupt or truncated"}
+	}
+
+	if int64(len(decompressedContent)) > limit {
+		// Too big is the client's upload, not our disk: 413 like the compressed limit
+		if limit == config.MaxDecompressedBytes {
+			return nil, &apiError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Code:    ERR_DECOMPRESSED_TOO_LARGE,
+				Message: fmt.Sprintf("Uncompressed feed exceeds %d bytes", config.MaxDecompressedBytes),
+			}
+		}
+		return nil, &apiError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    ERR_COMPRESSION_RATIO,
+			Message: fmt.Sprintf("Compression ratio exceeds %d:1", config.MaxCompressionRatio),
+		}
+	}
+
+	return decompressedContent, nil
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// channelHandler sends mapping diagnostics to their own handler and everything else to the main one
+type channelHandler struct {
+	main    slog.Handler
+	mapping slog.Handler
+}
+
+func (h *channelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.main.Enabled(ctx, level) || (h.mapping != nil && h.mapping.Enabled(ctx, level))
+}
+
+func (h *channelHandler) Handle(ctx context.Context, record slog.Record) error {
+	if h.mapping != nil && isMappingRecord(record) {
+		return h.mapping.Handle(ctx, record)
+	}
+	if !h.main.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.main.Handle(ctx, record)
+}
+
+func (h *channelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := &channelHandler{main: h.main.WithAttrs(attrs)}
+	if h.mapping != nil {
+		clone.mapping = h.mapping.WithAttrs(attrs)
+	}
+	return clone
+}
+
+func (h *channelHandler) WithGroup(name string) slog.Handler {
+	clone := &channelHandler{main: h.main.WithGroup(name)}
+	if h.mapping != nil {
+		clone.mapping = h.mapping.WithGroup(name)
+	}
+	return clone
+}
+
+func isMappingRecord(record slog.Record) bool {
+	found := false
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == CHANNEL_KEY && attr.Value.String() == CHANNEL_MAPPING {
+			found = true
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+//-------------------------------------------------------------------- Deduplication
+
+// dedupSet remembers the records already written, shared by every clone of the handler
+type dedupSet struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	max  int
+}
+
+// dedupHandler drops records whose message and own attributes were already logged.
+// Attributes added with With (request id, owner...) are not part of the key, same as the old notes file.
+type dedupHandler struct {
+	next slog.Handler
+	set  *dedupSet
+}
+
+func newDedupHandler(next slog.Handler, max int) *dedupHandler {
+	return &dedupHandler{next: next, set: &dedupSet{seen: make(map[string]struct{}), max: max}}
+}
+
+func (h *dedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, record slog.Record) error {
+	var key strings.Builder
+	key.WriteString(record.Message)
+	record.Attrs(func(attr slog.Attr) bool {
+		key.WriteString("\xff" + attr.String())
+		return true
+	})
+
+	h.set.mu.Lock()
+	if _, exists := h.set.seen[key.String()]; exists {
+		h.set.mu.Unlock()
+		return nil
+	}
+	// Start over instead of growing forever
+	if len(h.set.seen) >= h.set.max {
+		h.set.seen = make(map[string]struct{})
+	}
+	h.set.seen[key.String()] = struct{}{}
+	h.set.mu.Unlock()
+
+	return h.next.Handle(ctx, record)
+}
+
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &dedupHandler{next: h.next.WithAttrs(attrs), set: h.set}
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	return &dedupHandler{next: h.next.WithGroup(name), set: h.set}
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	CHANNEL_KEY     = "channel"
+	CHANNEL_MAPPING = "mapping"
+)
+
+// Config selects where and how much we log
+type Config struct {
+	Level  string // debug, info, warn, error
+	Format string // text or json
+	Output string // stdout, stderr or a file path
+
+	// Mapping diagnostics go to their own rotating file
+	MappingFile     string
+	MappingMaxBytes int64
+	MappingBackups  int
+}
+
+// Mapping marks a record as a mapping diagnostic (unmapped values, unknown attributes...)
+func Mapping() slog.Attr {
+	return slog.String(CHANNEL_KEY, CHANNEL_MAPPING)
+}
+
+// Setup builds the logger from the config and installs it as the slog default
+func Setup(config Config) (*slog.Logger, error) {
+	level, err := parseLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := openOutput(config.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var main slog.Handler
+	if strings.EqualFold(config.Format, "json") {
+		main = slog.NewJSONHandler(output, options)
+	} else {
+		main = slog.NewTextHandler(output, options)
+	}
+
+	var mapping slog.Handler
+	if config.MappingFile != "" {
+		rotating, err := NewRotatingFile(config.MappingFile, config.MappingMaxBytes, config.MappingBackups)
+		if err != nil {
+			return nil, err
+		}
+		mapping = newDedupHandler(slog.NewJSONHandler(rotating, &slog.HandlerOptions{Level: slog.LevelDebug}), 10000)
+	}
+
+	logger := slog.New(&channelHandler{main: main, mapping: mapping})
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+//-------------------------------------------------------------------- Request context
+
+type contextKey struct{}
+
+// WithLogger stores the request scoped logger in the context
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the request logger or the default one
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+//-------------------------------------------------------------------- Helpers
+
+func parseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level '%s'", level)
+}
+
+func openOutput(output string) (io.Writer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	return os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
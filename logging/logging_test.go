@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChannelHandler(t *testing.T) {
+	var main, mapping bytes.Buffer
+	logger := slog.New(&channelHandler{
+		main:    slog.NewTextHandler(&main, &slog.HandlerOptions{Level: slog.LevelInfo}),
+		mapping: slog.NewTextHandler(&mapping, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	}).With("request_id", "r1")
+
+	logger.Info("converting feed")
+	logger.Debug("feed data")
+	logger.Warn("attribute value not possible to map", Mapping(), "value", "Vivenda")
+	logger.Debug("attribute not in registry", Mapping(), "name", "Piscina")
+
+	if !strings.Contains(main.String(), "msg=\"converting feed\" request_id=r1") || strings.Contains(main.String(), "feed data") || strings.Contains(main.String(), "attribute") {
+		t.Errorf("main log =\n%s\nwant only the info record", main.String())
+	}
+	if !strings.Contains(mapping.String(), "Vivenda") || !strings.Contains(mapping.String(), "Piscina") || strings.Contains(mapping.String(), "converting feed") {
+		t.Errorf("mapping log =\n%s\nwant both mapping records, the debug one too", mapping.String())
+	}
+	if !strings.Contains(mapping.String(), "request_id=r1") {
+		t.Errorf("mapping log =\n%s\nwant the attributes added with With", mapping.String())
+	}
+
+	// Without a mapping file the diagnostics stay on the main log, at its level
+	main.Reset()
+	logger = slog.New(&channelHandler{main: slog.NewTextHandler(&main, &slog.HandlerOptions{Level: slog.LevelInfo})})
+	logger.Warn("attribute value not possible to map", Mapping())
+	logger.Debug("attribute not in registry", Mapping())
+	if !strings.Contains(main.String(), "not possible to map") || strings.Contains(main.String(), "not in registry") {
+		t.Errorf("main log without mapping file =\n%s\nwant the warning only", main.String())
+	}
+}
+
+func TestDedupHandler(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(newDedupHandler(slog.NewTextHandler(&output, nil), 3))
+
+	logger.Info("unmapped", "value", "a")
+	logger.Info("unmapped", "value", "a")
+	logger.With("request_id", "r2").Info("unmapped", "value", "a") // With attributes are not part of the key
+	logger.Info("unmapped", "value", "b")
+	if count := strings.Count(output.String(), "msg=unmapped"); count != 2 {
+		t.Errorf("logged %d records, want 2:\n%s", count, output.String())
+	}
+
+	// Reaching max forgets everything seen so far
+	output.Reset()
+	logger.Info("unmapped", "value", "c")
+	logger.Info("unmapped", "value", "d")
+	logger.Info("unmapped", "value", "a")
+	if !strings.Contains(output.String(), "value=d") || !strings.Contains(output.String(), "value=a") {
+		t.Errorf("after the reset logged\n%s\nwant d and a again", output.String())
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.log")
+	rotating, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		if _, err := rotating.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotating.Close()
+
+	// A write that would go over 10 bytes starts a new file; one and two are the oldest, dropped
+	want := map[string]string{path: "six\n", path + ".1": "four\nfive\n", path + ".2": "three\n"}
+	for file, content := range want {
+		got, err := os.ReadFile(file)
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(file), got, err, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want only 2 backups", filepath.Base(path))
+	}
+
+	// Reopening counts what is already there
+	rotating, err = NewRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotating.Write([]byte("sixteen\n"))
+	rotating.Close()
+	if got, _ := os.ReadFile(path); string(got) != "sixteen\n" {
+		t.Errorf("without backups the file = %q, want it truncated before the write", got)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"go-test/convert_to_rosetta"
+	"go-test/history"
+	"go-test/logging"
+	"go-test/report"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unmappedValue is one raw value the converter could not map, over the latest conversion of every owner
+type unmappedValue struct {
+	TypeURN   string   `json:"type_urn"`
+	Attribute string   `json:"attribute"`
+	Value     string   `json:"value"`
+	Count     int      `json:"count"`
+	Owners    []string `json:"owners"`
+}
+
+// synonymRequest assigns a raw value to a URN, optionally converting the affected feeds again
+type synonymRequest struct {
+	TypeURN   string `json:"type_urn"`
+	Value     string `json:"value"`
+	URN       string `json:"urn"`
+	Reconvert bool   `json:"reconvert"`
+}
+
+// reconversion is the outcome of converting one owner's feed again
+type reconversion struct {
+	Owner        string `json:"owner"`
+	ConversionID string `json:"conversion_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// mappingHandler serves the mapping editor API:
+// GET /mappings/unmapped, GET /mappings/urns?q=, GET|POST|DELETE /mappings/synonyms
+func mappingHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	// Mappings are shared by every owner, only admin keys may see or change them
+	if serverConfig.AuthEnabled {
+		key, err := keyStore.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, &apiError{Status: http.StatusUnauthorized, Code: ERR_UNAUTHORIZED, Message: err.Error()})
+			return
+		}
+		if !key.Admin {
+			writeError(w, &apiError{Status: http.StatusForbidden, Code: ERR_ADMIN_REQUIRED, Message: "Only admin keys can edit the mappings"})
+			return
+		}
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/mappings/") {
+	case "unmapped":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		values, err := collectUnmappedValues()
+		if err != nil {
+			logger.Error("error collecting unmapped values", "error", err)
+			http.Error(w, "Error collecting unmapped values", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, values)
+
+	case "urns":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 50
+		}
+		writeJSON(w, convert_to_rosetta.SearchURNs(r.URL.Query().Get("q"), limit))
+
+	case "synonyms":
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, convert_to_rosetta.Synonyms())
+		case http.MethodPost:
+			addSynonym(w, r)
+		case http.MethodDelete:
+			err := convert_to_rosetta.RemoveSynonym(r.URL.Query().Get("type_urn"), r.URL.Query().Get("value"))
+			if errors.Is(err, convert_to_rosetta.ErrSynonymsNotSaved) {
+				logger.Error("error saving synonyms", "error", err)
+				writeError(w, &apiError{Status: http.StatusInternalServerError, Code: ERR_WRITE_FAILED, Message: "Error saving the synonyms, nothing changed"})
+				return
+			}
+			if err != nil {
+				writeError(w, &apiError{Status: http.StatusNotFound, Code: ERR_NOT_FOUND, Message: err.Error()})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	default:
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: ERR_NOT_FOUND, Message: "Unknown mappings resource"})
+	}
+}
+
+// addSynonym saves the synonym and converts again the feeds that had the value unmapped
+func addSynonym(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var request synonymRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&request); err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: ERR_INVALID_REQUEST, Message: "Invalid JSON body"})
+		return
+	}
+
+	// Owners are found before the synonym makes the value disappear from the list
+	var affectedOwners []string
+	if request.Reconvert {
+		values, err := collectUnmappedValues()
+		if err != nil {
+			logger.Error("error collecting unmapped values", "error", err)
+		}
+		sanitized := convert_to_rosetta.SanitizeString(strings.TrimSpace(request.Value))
+		for _, value := range values {
+			if value.TypeURN == request.TypeURN && convert_to_rosetta.SanitizeString(value.Value) == sanitized {
+				affectedOwners = append(affectedOwners, value.Owners...)
+			}
+		}
+	}
+
+	synonym, err := convert_to_rosetta.AddSynonym(request.TypeURN, request.Value, request.URN)
+	if errors.Is(err, convert_to_rosetta.ErrSynonymsNotSaved) {
+		logger.Error("error saving synonyms", "error", err)
+		writeError(w, &apiError{Status: http.StatusInternalServerError, Code: ERR_WRITE_FAILED, Message: "Error saving the synonyms, nothing changed"})
+		return
+	}
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusUnprocessableEntity, Code: ERR_INVALID_REQUEST, Message: err.Error()})
+		return
+	}
+	logger.Info("synonym added", "type_urn", synonym.TypeURN, "value", synonym.Value, "urn", synonym.URN)
+
+	reconverted := []reconversion{}
+	for _, owner := range uniqueStrings(affectedOwners) {
+		outcome := reconversion{Owner: owner}
+		release, err := conversionGate.Acquire(r.Context())
+		if err != nil {
+			outcome.Error = err.Error()
+			reconverted = append(reconverted, outcome)
+			continue
+		}
+		entry, err := reconvertOwner(owner, logger.With("owner", owner))
+		release()
+		if err != nil {
+			logger.Error("error converting feed again", "owner", owner, "error", err)
+			outcome.Error = err.Error()
+		} else {
+			outcome.ConversionID = entry.ID
+		}
+		reconverted = append(reconverted, outcome)
+	}
+
+	writeJSON(w, map[string]interface{}{"synonym": synonym, "reconverted": reconverted})
+}
+
+// collectUnmappedValues counts the values still unmapped on the latest report of every owner
+func collectUnmappedValues() ([]unmappedValue, error) {
+	entries, err := conversionHistory.Latest(true)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]*unmappedValue{}
+	for _, entry := range entries {
+		if entry.Unmapped == 0 {
+			continue
+		}
+		conversionReport, err := readHistoryReport(entry.Owner, entry.ID)
+		if err != nil {
+			continue
+		}
+
+		for _, issue := range conversionReport.Issues {
+			if issue.Code != convert_to_rosetta.ISSUE_UNMAPPED_ATTRIBUTE {
+				continue
+			}
+			definition, exists := convert_to_rosetta.LookupAttribute(convert_to_rosetta.SanitizeString(issue.Field))
+			if !exists {
+				continue
+			}
+			// Mapped since, by a synonym or a registry change
+			if _, converted := definition.Convert(issue.Value); converted {
+				continue
+			}
+
+			key := definition.URN + "\x00" + convert_to_rosetta.SanitizeString(issue.Value)
+			value, seen := byKey[key]
+			if !seen {
+				value = &unmappedValue{TypeURN: definition.URN, Attribute: issue.Field, Value: issue.Value}
+				byKey[key] = value
+			}
+			value.Count++
+			if !containsFold(value.Owners, entry.Owner) {
+				value.Owners = append(value.Owners, entry.Owner)
+			}
+		}
+	}
+
+	values := make([]unmappedValue, 0, len(byKey))
+	for _, value := range byKey {
+		values = append(values, *value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		if values[i].TypeURN != values[j].TypeURN {
+			return values[i].TypeURN < values[j].TypeURN
+		}
+		return values[i].Value < values[j].Value
+	})
+	return values, nil
+}
+
+//------------------------------------------------------------------- Helpers
+
+func readHistoryReport(owner string, id string) (*report.Report, error) {
+	path, err := conversionHistory.FilePath(owner, id, history.FILE_REPORT)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var conversionReport report.Report
+	if err := json.Unmarshal(content, &conversionReport); err != nil {
+		return nil, err
+	}
+	return &conversionReport, nil
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func uniqueStrings(values []string) []string {
+	unique := []string{}
+	for _, value := range values {
+		if !containsFold(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+func containsFold(values []string, value string) bool {
+	for _, existing := range values {
+		if strings.EqualFold(existing, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics exposed on /metrics in the Prometheus text format
+var (
+	Conversions        = NewCounter("xmlconv_conversions_total", "Conversion requests by outcome.", "outcome")
+	AdvertsConverted   = NewCounter("xmlconv_adverts_converted_total", "Adverts converted to Rosetta.")
+	StageDuration      = NewHistogram("xmlconv_stage_duration_seconds", "Time spent on each conversion stage.", "stage")
+	UnmappedAttributes = NewCounter("xmlconv_unmapped_attributes_total", "Attribute values that could not be mapped, by type URN.", "type_urn")
+	CategoryMisses     = NewCounter("xmlconv_category_mapping_misses_total", "Adverts whose category could not be mapped, by offer type.", "offer_type")
+	BytesIn            = NewCounter("xmlconv_bytes_in_total", "Compressed bytes received.")
+	BytesOut           = NewCounter("xmlconv_bytes_out_total", "Rosetta XML bytes written.")
+	ImagesMirrored     = NewCounter("xmlconv_images_mirrored_total", "Images handled by the mirror, by result (fetched, cached, rejected, failed).", "result")
+)
+
+var registry []collector
+
+type collector interface {
+	write(w io.Writer)
+}
+
+//-------------------------------------------------------------------- Counter
+
+// Counter is a monotonically increasing value per label set
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name string, help string, labels ...string) *Counter {
+	counter := &Counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	registry = append(registry, counter)
+	return counter
+}
+
+// Inc adds one for the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta for the given label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, escapeHelp(c.help), c.name)
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %g\n", c.name, formatLabels(c.labels, key, ""), c.values[key])
+	}
+}
+
+//-------------------------------------------------------------------- Histogram
+
+var defaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram counts observations into cumulative buckets per label set
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+// NewHistogram creates and registers a histogram with the default latency buckets
+func NewHistogram(name string, help string, labels ...string) *Histogram {
+	histogram := &Histogram{name: name, help: help, labels: labels, buckets: defaultBuckets, values: make(map[string]*histogramValue)}
+	registry = append(registry, histogram)
+	return histogram
+}
+
+// Observe records one value for the given label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	v, exists := h.values[key]
+	if !exists {
+		v = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = v
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			v.counts[i]++
+		}
+	}
+	v.sum += value
+	v.count++
+}
+
+// ObserveSince records the seconds elapsed since start
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, escapeHelp(h.help), h.name)
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v := h.values[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, fmt.Sprintf("%g", bound)), v.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, formatLabels(h.labels, key, ""), v.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, ""), v.count)
+	}
+}
+
+//-------------------------------------------------------------------- Exposition
+
+// Handler serves every registered metric
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, c := range registry {
+			c.write(w)
+		}
+	})
+}
+
+//-------------------------------------------------------------------- Helpers
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels renders {a="x",b="y"} from the joined key, adding le for histogram buckets
+func formatLabels(names []string, key string, le string) string {
+	var pairs []string
+	if len(names) > 0 {
+		values := strings.Split(key, "\xff")
+		for i, name := range names {
+			value := ""
+			if i < len(values) {
+				value = values[i]
+			}
+			pairs = append(pairs, name+"=\""+escapeLabel(value)+"\"")
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, "le=\""+le+"\"")
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeHelp escapes the HELP text, where quotes are left as they are
+func escapeHelp(help string) string {
+	help = strings.ReplaceAll(help, "\\", "\\\\")
+	return strings.ReplaceAll(help, "\n", "\\n")
+}
+
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\"", "\\\"")
+	return strings.ReplaceAll(value, "\n", "\\n")
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterExposition(t *testing.T) {
+	counter := NewCounter("test_counter_total", "Values with a \\ and a\nnew line.", "path")
+	counter.Inc(`C:\feeds`)
+	counter.Add(2, "say \"hi\"\n")
+	counter.Inc(`C:\feeds`)
+
+	var exposition bytes.Buffer
+	counter.write(&exposition)
+	want := `# HELP test_counter_total Values with a \\ and a\nnew line.
+# TYPE test_counter_total counter
+test_counter_total{path="C:\\feeds"} 2
+test_counter_total{path="say \"hi\"\n"} 2
+`
+	if exposition.String() != want {
+		t.Errorf("counter exposition =\n%s\nwant\n%s", exposition.String(), want)
+	}
+
+	// Without labels the counter shows up before the first Inc
+	unlabeled := NewCounter("test_unlabeled_total", "Nothing yet.")
+	exposition.Reset()
+	unlabeled.write(&exposition)
+	if !strings.HasSuffix(exposition.String(), "\ntest_unlabeled_total 0\n") {
+		t.Errorf("unlabeled counter exposition =\n%s\nwant a 0 sample", exposition.String())
+	}
+}
+
+func TestHistogramExposition(t *testing.T) {
+	histogram := NewHistogram("test_duration_seconds", "Time spent.", "stage")
+	histogram.Observe(0.003, "parse")
+	histogram.Observe(0.2, "parse")
+	histogram.Observe(60, "parse")
+
+	var exposition bytes.Buffer
+	histogram.write(&exposition)
+	lines := strings.Split(strings.TrimSuffix(exposition.String(), "\n"), "\n")
+
+	// HELP, TYPE, one line per bucket, +Inf, sum and count
+	if len(lines) != 2+len(defaultBuckets)+3 {
+		t.Fatalf("histogram exposition has %d lines, want %d:\n%s", len(lines), 2+len(defaultBuckets)+3, exposition.String())
+	}
+	for _, want := range []string{
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{stage="parse",le="0.001"} 0`,
+		`test_duration_seconds_bucket{stage="parse",le="0.005"} 1`,
+		`test_duration_seconds_bucket{stage="parse",le="0.25"} 2`,
+		`test_duration_seconds_bucket{stage="parse",le="30"} 2`,
+		`test_duration_seconds_bucket{stage="parse",le="+Inf"} 3`,
+		`test_duration_seconds_sum{stage="parse"} 60.203`,
+		`test_duration_seconds_count{stage="parse"} 3`,
+	} {
+		if !strings.Contains(exposition.String(), want+"\n") {
+			t.Errorf("histogram exposition misses %q:\n%s", want, exposition.String())
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), "# TYPE xmlconv_conversions_total counter\n") {
+		t.Errorf("/metrics misses the registered counters:\n%s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,382 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-test/metrics"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Image types we keep, by sniffed content type
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ErrNotImage is returned when the server answers with something that is not a JPEG, PNG, GIF or WebP
+var ErrNotImage = errors.New("not an image")
+
+// Client downloads the images; *http.Client does, tests plug a stub server client
+type Client interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// Config of the mirror
+type Config struct {
+	Dir             string        // where the images, thumbnails and the hash cache go
+	BaseURL         string        // public URL of Dir, goes on <image><url>
+	Concurrency     int           // downloads (and their decoding for the thumbnails) at the same time, across every conversion
+	MaxBytes        int64         // bigger images are not mirrored
+	ThumbnailWidths []int         // a JPEG thumbnail per width, for images wider than it
+	RevalidateAfter time.Duration // cached images older than this are checked again with a conditional GET, 0 never
+	Client          Client
+}
+
+// Result of one image: URL is the mirrored one, Err says why the source URL stays (or the image goes)
+type Result struct {
+	Source string
+	URL    string
+	Hash   string
+	Cached bool
+	Err    error
+}
+
+type cacheEntry struct {
+	Hash         string    `json:"hash"`
+	Extension    string    `json:"extension"`
+	FetchedAt    time.Time `json:"fetched_at"` // last download or revalidation
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+}
+
+// download is what fetch got: the image, or notModified when the cached copy is still the one
+type download struct {
+	content      []byte
+	extension    string
+	etag         string
+	lastModified string
+	notModified  bool
+}
+
+// Mirror stores the images under <dir>/<first 2 hex of the hash>/<sha256>.<ext>,
+// remembering the hash of every source URL so an image is only downloaded again when it changed
+type Mirror struct {
+	config Config
+	slots  chan struct{}
+
+	mu       sync.Mutex
+	cache    map[string]cacheEntry
+	inflight map[string]*flight
+}
+
+// flight is one source URL being mirrored, the other callers asking for it wait for its result
+type flight struct {
+	done   chan struct{}
+	result Result
+}
+
+// Paths served by Handler: the images and their thumbnails, never the cache
+var servedPattern = regexp.MustCompile(`^[0-9a-f]{2}/[0-9a-f]{64}(_[0-9]+)?\.(jpg|png|gif|webp)$`)
+
+// New creates the mirror directory and loads the hash cache
+func New(config Config) (*Mirror, error) {
+	if config.BaseURL == "" {
+		return nil, fmt.Errorf("mirror base URL is not set")
+	}
+	if config.Client == nil {
+		config.Client = SafeClient(30 * time.Second)
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating mirror directory: %v", err)
+	}
+
+	m := &Mirror{config: config, slots: make(chan struct{}, config.Concurrency), cache: map[string]cacheEntry{}, inflight: map[string]*flight{}}
+	content, err := os.ReadFile(m.cachePath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &m.cache); err != nil {
+			return nil, fmt.Errorf("Error reading mirror cache: %v", err)
+		}
+	}
+	return m, nil
+}
+
+// MirrorAll mirrors the images of one advert, the results on the same order as the URLs;
+// the error is about saving the hash cache, the images themselves are fine
+func (m *Mirror) MirrorAll(sourceURLs []string) ([]Result, error) {
+	results := make([]Result, len(sourceURLs))
+
+	var wg sync.WaitGroup
+	for i, sourceURL := range sourceURLs {
+		wg.Add(1)
+		go func(i int, sourceURL string) {
+			defer wg.Done()
+			results[i] = m.Mirror(sourceURL)
+		}(i, sourceURL)
+	}
+	wg.Wait()
+
+	// Revalidated entries changed their date, a save is cheap next to the downloads
+	fetched := false
+	for _, result := range results {
+		fetched = fetched || result.Err == nil
+	}
+	if fetched {
+		if err := m.saveCache(); err != nil {
+			return results, fmt.Errorf("Error saving mirror cache: %v", err)
+		}
+	}
+	return results, nil
+}
+
+// Mirror downloads one image unless its hash is cached and the file is still there.
+// Cached images older than RevalidateAfter are asked again with their ETag or date: agencies replace photos on the same URL.
+// The same URL asked by several adverts or conversions at once is downloaded once.
+func (m *Mirror) Mirror(sourceURL string) Result {
+	m.mu.Lock()
+	if running, exists := m.inflight[sourceURL]; exists {
+		m.mu.Unlock()
+		<-running.done
+		return running.result
+	}
+	running := &flight{done: make(chan struct{})}
+	m.inflight[sourceURL] = running
+	m.mu.Unlock()
+
+	running.result = m.mirror(sourceURL)
+
+	m.mu.Lock()
+	delete(m.inflight, sourceURL)
+	m.mu.Unlock()
+	close(running.done)
+	return running.result
+}
+
+func (m *Mirror) mirror(sourceURL string) Result {
+	result := Result{Source: sourceURL, URL: sourceURL}
+
+	m.mu.Lock()
+	cached, isCached := m.cache[sourceURL]
+	m.mu.Unlock()
+	if isCached {
+		if _, err := os.Stat(m.filePath(cached.Hash, cached.Extension)); err != nil {
+			isCached = false
+		}
+	}
+	cachedResult := func() Result {
+		metrics.ImagesMirrored.Inc("cached")
+		result.URL = m.publicURL(cached.Hash, cached.Extension)
+		result.Hash = cached.Hash
+		result.Cached = true
+		return result
+	}
+	if isCached && (m.config.RevalidateAfter <= 0 || time.Since(cached.FetchedAt) < m.config.RevalidateAfter) {
+		return cachedResult()
+	}
+
+	// Bounded across every conversion, agency servers rate-limit us too. The slot is held until the
+	// thumbnails are made: decoding an image takes far more memory than its download
+	validators := cacheEntry{}
+	if isCached {
+		validators = cached
+	}
+	m.slots <- struct{}{}
+	defer func() { <-m.slots }()
+	fetched, err := m.fetch(sourceURL, validators)
+	if err != nil {
+		// A server down keeps the copy we have; an URL that stopped serving an image does not
+		if isCached && !errors.Is(err, ErrNotImage) {
+			return cachedResult()
+		}
+		if errors.Is(err, ErrNotImage) {
+			metrics.ImagesMirrored.Inc("rejected")
+		} else {
+			metrics.ImagesMirrored.Inc("failed")
+		}
+		result.Err = err
+		return result
+	}
+	if fetched.notModified {
+		m.mu.Lock()
+		cached.FetchedAt = time.Now().UTC()
+		m.cache[sourceURL] = cached
+		m.mu.Unlock()
+		return cachedResult()
+	}
+
+	sum := sha256.Sum256(fetched.content)
+	hash := hex.EncodeToString(sum[:])
+	extension := fetched.extension
+	if err := m.store(hash, extension, fetched.content); err != nil {
+		metrics.ImagesMirrored.Inc("failed")
+		result.Err = err
+		return result
+	}
+	metrics.ImagesMirrored.Inc("fetched")
+
+	m.mu.Lock()
+	m.cache[sourceURL] = cacheEntry{Hash: hash, Extension: extension, FetchedAt: time.Now().UTC(), ETag: fetched.etag, LastModified: fetched.lastModified}
+	m.mu.Unlock()
+
+	result.URL = m.publicURL(hash, extension)
+	result.Hash = hash
+	return result
+}
+
+// Handler serves the mirrored images and thumbnails under the prefix it is mounted on
+func (m *Mirror) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		if !servedPattern.MatchString(name) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		http.ServeFile(w, r, filepath.Join(m.config.Dir, filepath.FromSlash(name)))
+	})
+}
+
+//-------------------------------------------------------------------- Helpers
+
+// fetch downloads the image and checks both the announced and the real content type;
+// with the validators of a cached copy it is a conditional GET
+func (m *Mirror) fetch(sourceURL string, validators cacheEntry) (download, error) {
+	request, err := http.NewRequest(http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return download{}, err
+	}
+	if validators.ETag != "" {
+		request.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		request.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+	response, err := m.config.Client.Do(request)
+	if err != nil {
+		return download{}, fmt.Errorf("Error downloading image: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && validators.Hash != "" {
+		return download{notModified: true}, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return download{}, fmt.Errorf("Error downloading image: status %d", response.StatusCode)
+	}
+	announced := strings.ToLower(strings.TrimSpace(strings.Split(response.Header.Get("Content-Type"), ";")[0]))
+	if announced != "" && !strings.HasPrefix(announced, "image/") {
+		return download{}, fmt.Errorf("%w: content type %s", ErrNotImage, announced)
+	}
+
+	reader := io.Reader(response.Body)
+	if m.config.MaxBytes > 0 {
+		reader = io.LimitReader(response.Body, m.config.MaxBytes+1)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return download{}, fmt.Errorf("Error downloading image: %v", err)
+	}
+	if m.config.MaxBytes > 0 && int64(len(content)) > m.config.MaxBytes {
+		return download{}, fmt.Errorf("image is over %d bytes", m.config.MaxBytes)
+	}
+
+	// The header may lie, the first bytes do not
+	extension, known := imageExtensions[http.DetectContentType(content)]
+	if !known {
+		return download{}, fmt.Errorf("%w: content is %s", ErrNotImage, http.DetectContentType(content))
+	}
+	return download{content: content, extension: extension, etag: response.Header.Get("ETag"), lastModified: response.Header.Get("Last-Modified")}, nil
+}
+
+// store writes the image and its thumbnails; the same content is only written once
+func (m *Mirror) store(hash string, extension string, content []byte) error {
+	path := m.filePath(hash, extension)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := writeFile(path, content); err != nil {
+		return fmt.Errorf("Error writing mirrored image: %v", err)
+	}
+
+	// Thumbnails are a bonus: an image we cannot decode (WebP) is still mirrored
+	for _, width := range m.config.ThumbnailWidths {
+		thumbnail, err := Thumbnail(content, width)
+		if err != nil || thumbnail == nil {
+			continue
+		}
+		writeFile(m.thumbnailPath(hash, width), thumbnail)
+	}
+	return nil
+}
+
+func (m *Mirror) saveCache() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content, err := json.MarshalIndent(m.cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(m.cachePath(), content)
+}
+
+func (m *Mirror) cachePath() string {
+	return filepath.Join(m.config.Dir, "cache.json")
+}
+
+func (m *Mirror) filePath(hash string, extension string) string {
+	return filepath.Join(m.config.Dir, hash[:2], hash+extension)
+}
+
+func (m *Mirror) thumbnailPath(hash string, width int) string {
+	return filepath.Join(m.config.Dir, hash[:2], fmt.Sprintf("%s_%d.jpg", hash, width))
+}
+
+func (m *Mirror) publicURL(hash string, extension string) string {
+	return m.config.BaseURL + "/" + hash[:2] + "/" + hash + extension
+}
+
+// writeFile goes through a temporary file so a reader never sees half an image;
+// a unique one, two URLs with the same content are stored at the same time
+func writeFile(path string, content []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	_, err = tmpFile.Write(content)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
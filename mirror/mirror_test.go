@@ -0,0 +1,257 @@
+package mirror
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	picture := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	for x := 0; x < 1000; x++ {
+		picture.Set(x, x/2, color.RGBA{R: 200, A: 255})
+	}
+	var content bytes.Buffer
+	png.Encode(&content, picture)
+
+	var downloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		switch r.URL.Path {
+		case "/photo.png", "/same-photo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(content.Bytes())
+		case "/lying.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("<html>not found</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	imageMirror, err := New(Config{Dir: dir, BaseURL: "https://static.example.pt/images/", Concurrency: 2, ThumbnailWidths: []int{320, 2000}, Client: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := imageMirror.MirrorAll([]string{server.URL + "/photo.png", server.URL + "/same-photo.png", server.URL + "/lying.jpg", server.URL + "/gone.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	photo := results[0]
+	if photo.Err != nil || !strings.HasPrefix(photo.URL, "https://static.example.pt/images/"+photo.Hash[:2]+"/"+photo.Hash) || !strings.HasSuffix(photo.URL, ".png") {
+		t.Errorf("mirrored photo = %+v", photo)
+	}
+	if results[1].Hash != photo.Hash {
+		t.Errorf("same content got another hash: %s, %s", results[1].Hash, photo.Hash)
+	}
+	if !errors.Is(results[2].Err, ErrNotImage) {
+		t.Errorf("HTML served as JPEG = %v, want ErrNotImage", results[2].Err)
+	}
+	if results[3].Err == nil || errors.Is(results[3].Err, ErrNotImage) || results[3].URL != server.URL+"/gone.jpg" {
+		t.Errorf("missing image = %+v, want a download error and the source URL", results[3])
+	}
+
+	// One thumbnail, the image is narrower than 2000
+	if _, err := os.Stat(filepath.Join(dir, photo.Hash[:2], photo.Hash+"_320.jpg")); err != nil {
+		t.Errorf("thumbnail missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, photo.Hash[:2], photo.Hash+"_2000.jpg")); err == nil {
+		t.Error("thumbnail wider than the image was generated")
+	}
+
+	// The hash cache survives a restart and the image is not downloaded again
+	before := atomic.LoadInt32(&downloads)
+	reopened, err := New(Config{Dir: dir, BaseURL: "https://static.example.pt/images", Client: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := reopened.Mirror(server.URL + "/photo.png")
+	if !again.Cached || again.URL != photo.URL || atomic.LoadInt32(&downloads) != before {
+		t.Errorf("cached image = %+v, downloads %d -> %d", again, before, atomic.LoadInt32(&downloads))
+	}
+
+	// Only images are served, not the cache
+	handler := reopened.Handler()
+	for path, status := range map[string]int{
+		"/" + photo.Hash[:2] + "/" + photo.Hash + ".png":     http.StatusOK,
+		"/" + photo.Hash[:2] + "/" + photo.Hash + "_320.jpg": http.StatusOK,
+		"/cache.json": http.StatusNotFound,
+		"/../go.mod":  http.StatusNotFound,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != status {
+			t.Errorf("GET %s = %d, want %d", path, recorder.Code, status)
+		}
+	}
+}
+
+func TestMirrorRevalidates(t *testing.T) {
+	var content bytes.Buffer
+	png.Encode(&content, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	first := content.Bytes()
+	content.Reset()
+	png.Encode(&content, image.NewRGBA(image.Rect(0, 0, 20, 20)))
+	replaced := content.Bytes()
+
+	// The agency replaces the photo on the same URL, the ETag tells
+	var served atomic.Value
+	served.Store(first)
+	var notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := served.Load().([]byte)
+		etag := fmt.Sprintf(`"%d"`, len(current))
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(current)
+	}))
+	defer server.Close()
+
+	imageMirror, err := New(Config{Dir: t.TempDir(), BaseURL: "https://static.example.pt/images", RevalidateAfter: time.Nanosecond, Client: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := imageMirror.Mirror(server.URL + "/photo.png")
+	if original.Err != nil {
+		t.Fatal(original.Err)
+	}
+
+	again := imageMirror.Mirror(server.URL + "/photo.png")
+	if !again.Cached || again.Hash != original.Hash || atomic.LoadInt32(&notModified) != 1 {
+		t.Errorf("unchanged image = %+v, %d not modified answers, want the cached copy after a 304", again, notModified)
+	}
+
+	served.Store(replaced)
+	changed := imageMirror.Mirror(server.URL + "/photo.png")
+	if changed.Err != nil || changed.Cached || changed.Hash == original.Hash {
+		t.Errorf("replaced image = %+v, want a new copy", changed)
+	}
+
+	// With the server down the copy we have is still served
+	server.Close()
+	if down := imageMirror.Mirror(server.URL + "/photo.png"); down.Err != nil || down.Hash != changed.Hash {
+		t.Errorf("image with the server down = %+v, want the cached copy", down)
+	}
+}
+
+func TestMirrorSameURLOnce(t *testing.T) {
+	var content bytes.Buffer
+	png.Encode(&content, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+
+	// Slow enough for every advert to ask while the first download is running
+	var downloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(content.Bytes())
+	}))
+	defer server.Close()
+
+	imageMirror, err := New(Config{Dir: t.TempDir(), BaseURL: "https://static.example.pt/images", Concurrency: 4, Client: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceURL := server.URL + "/photo.png"
+	results, err := imageMirror.MirrorAll([]string{sourceURL, sourceURL, sourceURL, sourceURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&downloads) != 1 {
+		t.Errorf("%d downloads of the same URL, want 1", downloads)
+	}
+	for i, result := range results {
+		if result.Err != nil || result.Hash != results[0].Hash {
+			t.Errorf("result %d = %+v, want the shared download", i, result)
+		}
+	}
+}
+
+func TestWriteFileConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "same.png")
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- writeFile(path, []byte("same content"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent writeFile: %v", err)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("%d files left, want only %s", len(entries), path)
+	}
+}
+
+func TestBlockedAddress(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.10":    true,
+		"169.254.169.254": true, // cloud metadata
+		"100.64.0.1":      true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"::ffff:10.0.0.1": true,
+
+		"8.8.8.8":              false,
+		"185.15.59.224":        false,
+		"2a00:1450:4003::200e": false,
+	}
+
+	for address, want := range tests {
+		if got := BlockedAddress(net.ParseIP(address)); got != want {
+			t.Errorf("BlockedAddress(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestSafeClientRefusesLocalServers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+	}))
+	defer server.Close()
+
+	imageMirror, err := New(Config{Dir: t.TempDir(), BaseURL: "https://static.example.pt/images", Client: SafeClient(time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := imageMirror.Mirror(server.URL + "/photo.png"); !errors.Is(result.Err, ErrBlockedAddress) {
+		t.Errorf("image on a loopback server = %+v, want ErrBlockedAddress", result)
+	}
+}
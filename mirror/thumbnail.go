@@ -0,0 +1,85 @@
+package mirror
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+// Images over this many pixels are mirrored without thumbnails, decoding them would take too much memory
+const MAX_THUMBNAIL_SOURCE_PIXELS = 50_000_000
+
+// JPEG quality of the thumbnails
+const THUMBNAIL_QUALITY = 85
+
+// Thumbnail scales the image down to width keeping the aspect ratio; nil when it is not wider than that
+func Thumbnail(content []byte, width int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= width || width <= 0 {
+		return nil, nil
+	}
+	if config.Width*config.Height > MAX_THUMBNAIL_SOURCE_PIXELS {
+		return nil, fmt.Errorf("image of %dx%d is too big for a thumbnail", config.Width, config.Height)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	// JPEG has no transparency: transparent pixels end up white instead of black
+	source := image.NewRGBA(decoded.Bounds())
+	draw.Draw(source, source.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(source, source.Bounds(), decoded, decoded.Bounds().Min, draw.Over)
+
+	height := max(1, config.Height*width/config.Width)
+	scaled := scaleDown(source, width, height)
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, scaled, &jpeg.Options{Quality: THUMBNAIL_QUALITY}); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// scaleDown averages the source pixels under every target pixel (box filter), enough for photos
+func scaleDown(source *image.RGBA, width int, height int) *image.RGBA {
+	target := image.NewRGBA(image.Rect(0, 0, width, height))
+	sourceWidth := source.Bounds().Dx()
+	sourceHeight := source.Bounds().Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := y * sourceHeight / height
+		y1 := max(y0+1, (y+1)*sourceHeight/height)
+		for x := 0; x < width; x++ {
+			x0 := x * sourceWidth / width
+			x1 := max(x0+1, (x+1)*sourceWidth/width)
+
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := sy*source.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += int(source.Pix[offset])
+					g += int(source.Pix[offset+1])
+					b += int(source.Pix[offset+2])
+					a += int(source.Pix[offset+3])
+					offset += 4
+				}
+				count += x1 - x0
+			}
+
+			i := y*target.Stride + x*4
+			target.Pix[i] = uint8(r / count)
+			target.Pix[i+1] = uint8(g / count)
+			target.Pix[i+2] = uint8(b / count)
+			target.Pix[i+3] = uint8(a / count)
+		}
+	}
+	return target
+}
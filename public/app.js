@@ -0,0 +1,271 @@
+'use strict';
+
+// Same origin as the page, wherever the server runs
+const convertEndpoint = 'convert';
+const historyEndpoint = 'history';
+
+let selectedFile = null;
+
+const dropZone = document.getElementById('dropZone');
+const fileInput = document.getElementById('fileInput');
+const uploadButton = document.getElementById('uploadButton');
+const progress = document.getElementById('progress');
+
+//------------------------------------------------------------------- File selection
+
+function selectFile(file) {
+    selectedFile = file || null;
+    document.getElementById('fileName').textContent = selectedFile ? selectedFile.name + ' (' + formatBytes(selectedFile.size) + ')' : '';
+    uploadButton.disabled = !selectedFile;
+}
+
+fileInput.addEventListener('change', () => selectFile(fileInput.files[0]));
+
+dropZone.addEventListener('dragover', (event) => {
+    event.preventDefault();
+    dropZone.classList.add('over');
+});
+dropZone.addEventListener('dragleave', () => dropZone.classList.remove('over'));
+dropZone.addEventListener('drop', (event) => {
+    event.preventDefault();
+    dropZone.classList.remove('over');
+    selectFile(event.dataTransfer.files[0]);
+});
+dropZone.addEventListener('keydown', (event) => {
+    if (event.key === 'Enter' || event.key === ' ') {
+        fileInput.click();
+    }
+});
+
+//------------------------------------------------------------------- Upload
+
+// The server only takes gzip, plain XML is compressed by the browser itself
+async function gzipFile(file) {
+    const head = new Uint8Array(await file.slice(0, 2).arrayBuffer());
+    if (head[0] === 0x1f && head[1] === 0x8b) {
+        return file;
+    }
+    if (typeof CompressionStream === 'undefined') {
+        throw new Error('This browser cannot compress files, upload a .xml.gz instead');
+    }
+    const stream = file.stream().pipeThrough(new CompressionStream('gzip'));
+    return new Blob([await new Response(stream).arrayBuffer()], { type: 'application/gzip' });
+}
+
+async function uploadFile() {
+    if (!selectedFile) {
+        return;
+    }
+    uploadButton.disabled = true;
+    setStatus('Compressing...');
+
+    let compressed;
+    try {
+        compressed = await gzipFile(selectedFile);
+    } catch (error) {
+        setStatus(error.message, true);
+        uploadButton.disabled = false;
+        return;
+    }
+
+    const params = new URLSearchParams();
+    if (document.getElementById('dryRun').checked) {
+        params.set('dry_run', 'true');
+    }
+    if (document.getElementById('strict').checked) {
+        params.set('strict', 'true');
+    }
+    if (document.getElementById('pretty').checked) {
+        params.set('pretty', 'true');
+    }
+
+    const formData = new FormData();
+    formData.append('file', compressed, 'file');
+
+    // XMLHttpRequest, fetch still has no upload progress
+    const request = new XMLHttpRequest();
+    request.open('POST', convertEndpoint + '?' + params.toString());
+    setAuthHeader(request);
+
+    progress.hidden = false;
+    progress.value = 0;
+    request.upload.onprogress = (event) => {
+        if (event.lengthComputable) {
+            progress.value = Math.round(event.loaded / event.total * 100);
+            setStatus('Uploading ' + progress.value + '%');
+        }
+    };
+    request.upload.onload = () => setStatus('Converting...');
+
+    request.onload = () => {
+        progress.hidden = true;
+        uploadButton.disabled = false;
+        let body = null;
+        try {
+            body = JSON.parse(request.responseText);
+        } catch (error) {
+            body = null;
+        }
+        if (request.status !== 200 || !body) {
+            const message = body && body.message ? body.message : request.responseText;
+            setStatus('Conversion failed (' + request.status + '): ' + message, true);
+            return;
+        }
+        setStatus(body.dry_run ? 'Dry run finished, nothing was published' : 'Conversion finished');
+        showResult(body);
+        loadHistory();
+    };
+    request.onerror = () => {
+        progress.hidden = true;
+        uploadButton.disabled = false;
+        setStatus('Network error', true);
+    };
+
+    request.send(formData);
+}
+
+uploadButton.addEventListener('click', uploadFile);
+
+//------------------------------------------------------------------- Result
+
+function showResult(conversionReport) {
+    document.getElementById('result').hidden = false;
+
+    const summary = document.getElementById('summary');
+    summary.replaceChildren();
+    addSummary(summary, 'Mode', conversionReport.dry_run ? 'Dry run' : 'Published');
+    addSummary(summary, 'Adverts', conversionReport.advert_count);
+    addSummary(summary, 'Rejected', (conversionReport.rejected_adverts || []).join(', ') || 'none');
+    addSummary(summary, 'Encoding', conversionReport.encoding + ' (' + conversionReport.encoding_source + ')');
+    addSummary(summary, 'Output SHA-256', conversionReport.output_sha256 || '');
+
+    const downloads = document.getElementById('downloads');
+    downloads.replaceChildren();
+    if (conversionReport.conversion_id) {
+        downloads.append('Download: ', downloadLinks(conversionReport.conversion_id, conversionReport.owner));
+    }
+
+    const issues = conversionReport.issues || [];
+    fillTable('unmapped', unmappedRows(issues));
+    fillTable('issues', issues.map((issue) => [
+        { text: issue.level, className: 'level-' + issue.level },
+        issue.code, issue.external_id || '', issue.field || '', issue.value || '', issue.message,
+    ]));
+
+    const categories = conversionReport.categories || [];
+    document.getElementById('categoriesBlock').hidden = categories.length === 0;
+    fillTable('categories', categories.map((category) => [
+        category.external_id, category.offer_type, category.category,
+        { text: category.urn || 'not resolved', className: category.urn ? '' : 'level-error' },
+        category.source,
+        { text: category.confidence.toFixed(2), className: category.confidence < 0.6 ? 'level-warning' : '' },
+    ]));
+
+    const preview = document.getElementById('preview');
+    preview.replaceChildren();
+    for (const advert of conversionReport.preview || []) {
+        const pre = document.createElement('pre');
+        pre.textContent = advert;
+        preview.append(pre);
+    }
+    document.getElementById('previewBlock').hidden = !(conversionReport.preview || []).length;
+}
+
+// Unmapped values grouped by attribute and value, most frequent first
+function unmappedRows(issues) {
+    const counts = new Map();
+    for (const issue of issues) {
+        if (issue.code !== 'unmapped_attribute_value') {
+            continue;
+        }
+        const key = issue.field + '\u0000' + issue.value;
+        counts.set(key, (counts.get(key) || 0) + 1);
+    }
+    return [...counts.entries()]
+        .sort((a, b) => b[1] - a[1])
+        .map(([key, count]) => [...key.split('\u0000'), count]);
+}
+
+function addSummary(list, label, value) {
+    const term = document.createElement('dt');
+    term.textContent = label;
+    const description = document.createElement('dd');
+    description.textContent = value;
+    list.append(term, description);
+}
+
+//------------------------------------------------------------------- History
+
+async function loadHistory() {
+    const owner = document.getElementById('ownerFilter').value.trim();
+    const url = historyEndpoint + (owner ? '?owner=' + encodeURIComponent(owner) : '');
+    let response;
+    try {
+        response = await fetch(url, { headers: authHeaders() });
+    } catch (error) {
+        fillTable('historyTable', [], 'Could not load the history');
+        return;
+    }
+    if (!response.ok) {
+        fillTable('historyTable', [], response.status === 401 ? 'Enter an API key to see the history' : 'Could not load the history (' + response.status + ')');
+        return;
+    }
+
+    const entries = await response.json();
+    fillTable('historyTable', entries.map((entry) => [
+        new Date(entry.created_at).toLocaleString(),
+        entry.owner,
+        entry.dry_run ? 'dry run' : 'published',
+        entry.adverts,
+        entry.rejected,
+        { text: entry.errors, className: entry.errors ? 'level-error' : '' },
+        { text: entry.warnings, className: entry.warnings ? 'level-warning' : '' },
+        entry.unmapped,
+        { node: downloadLinks(entry.id, entry.owner) },
+    ]), 'No conversions yet');
+}
+
+document.getElementById('historyButton').addEventListener('click', loadHistory);
+
+function downloadLinks(id, owner) {
+    const links = document.createElement('span');
+    for (const kind of ['input', 'output', 'report']) {
+        const button = document.createElement('button');
+        button.className = 'link-button';
+        button.textContent = kind;
+        button.addEventListener('click', () => download(id, owner, kind));
+        links.append(button);
+    }
+    return links;
+}
+
+// Fetch with the key header and hand the blob to the browser
+async function download(id, owner, kind) {
+    const url = historyEndpoint + '/' + encodeURIComponent(id) + '/' + kind + '?owner=' + encodeURIComponent(owner);
+    const response = await fetch(url, { headers: authHeaders() });
+    if (!response.ok) {
+        setStatus('Download failed (' + response.status + ')', true);
+        return;
+    }
+    const disposition = response.headers.get('Content-Disposition') || '';
+    const match = disposition.match(/filename="([^"]+)"/);
+    const link = document.createElement('a');
+    link.href = URL.createObjectURL(await response.blob());
+    link.download = match ? match[1] : id + '-' + kind;
+    link.click();
+    URL.revokeObjectURL(link.href);
+}
+
+//------------------------------------------------------------------- Helpers
+
+function formatBytes(bytes) {
+    if (bytes < 1024) {
+        return bytes + ' B';
+    }
+    if (bytes < 1024 * 1024) {
+        return (bytes / 1024).toFixed(1) + ' KB';
+    }
+    return (bytes / 1024 / 1024).toFixed(1) + ' MB';
+}
+
+loadHistory();
@@ -0,0 +1,57 @@
+'use strict';
+
+// Helpers shared by the dashboard pages
+
+const apiKeyInput = document.getElementById('apiKey');
+const statusLine = document.getElementById('status');
+
+// Keep the key for the browser tab only
+apiKeyInput.value = sessionStorage.getItem('apiKey') || '';
+apiKeyInput.addEventListener('change', () => sessionStorage.setItem('apiKey', apiKeyInput.value));
+
+function authHeaders() {
+    return apiKeyInput.value ? { 'Authorization': 'Bearer ' + apiKeyInput.value } : {};
+}
+
+function setAuthHeader(request) {
+    if (apiKeyInput.value) {
+        request.setRequestHeader('Authorization', 'Bearer ' + apiKeyInput.value);
+    }
+}
+
+function setStatus(message, isError) {
+    statusLine.textContent = message;
+    statusLine.className = isError ? 'error' : '';
+}
+
+// Cells are plain values, {text, className} or {node}; always set as text, never as HTML
+function fillTable(id, rows, emptyMessage) {
+    const table = document.getElementById(id);
+    const body = table.querySelector('tbody');
+    body.replaceChildren();
+    if (rows.length === 0) {
+        const row = body.insertRow();
+        const cell = row.insertCell();
+        cell.colSpan = table.querySelectorAll('thead th').length;
+        cell.className = 'empty';
+        cell.textContent = emptyMessage || 'Nothing to show';
+        return;
+    }
+    for (const values of rows) {
+        const row = body.insertRow();
+        for (const value of values) {
+            const cell = row.insertCell();
+            if (value !== null && typeof value === 'object') {
+                if (value.node) {
+                    cell.append(value.node);
+                } else {
+                    cell.textContent = value.text;
+                    cell.className = value.className || '';
+                }
+            } else {
+                cell.textContent = value;
+            }
+        }
+    }
+}
+
@@ -0,0 +1,162 @@
+'use strict';
+
+const mappingsEndpoint = 'mappings/';
+
+//------------------------------------------------------------------- Unmapped values
+
+async function loadUnmapped() {
+    const response = await request('GET', 'unmapped');
+    if (!response) {
+        fillTable('unmapped', [], 'Could not load the unmapped values');
+        return;
+    }
+    const values = await response.json();
+    fillTable('unmapped', values.map((value) => [
+        value.attribute + ' (' + value.type_urn + ')',
+        value.value,
+        value.count,
+        value.owners.join(', '),
+        { node: assignForm(value) },
+    ]), 'Every value is mapped');
+}
+
+// URN input with search suggestions and an assign button
+function assignForm(value) {
+    const form = document.createElement('form');
+    const input = document.createElement('input');
+    input.setAttribute('list', 'urnList');
+    input.placeholder = 'Search URN...';
+    input.required = true;
+    input.addEventListener('input', () => searchURNs(input.value));
+    const button = document.createElement('button');
+    button.textContent = 'Assign';
+    form.append(input, button);
+
+    form.addEventListener('submit', async (event) => {
+        event.preventDefault();
+        button.disabled = true;
+        await assign(value, input.value.trim());
+        button.disabled = false;
+    });
+    return form;
+}
+
+let searchTimer = null;
+
+// Suggestions from urnValues, refreshed while typing
+function searchURNs(query) {
+    clearTimeout(searchTimer);
+    searchTimer = setTimeout(async () => {
+        const response = await request('GET', 'urns?q=' + encodeURIComponent(query));
+        if (!response) {
+            return;
+        }
+        const list = document.getElementById('urnList');
+        list.replaceChildren();
+        for (const urn of await response.json()) {
+            const option = document.createElement('option');
+            option.value = urn.urn;
+            option.label = urn.value;
+            list.append(option);
+        }
+    }, 200);
+}
+
+async function assign(value, urn) {
+    const reconvert = document.getElementById('reconvert').checked;
+    setStatus(reconvert ? 'Saving and converting the affected feeds...' : 'Saving...');
+    const response = await request('POST', 'synonyms', {
+        type_urn: value.type_urn,
+        value: value.value,
+        urn: urn,
+        reconvert: reconvert,
+    });
+    if (!response) {
+        return;
+    }
+
+    const result = await response.json();
+    const failed = result.reconverted.filter((outcome) => outcome.error);
+    let message = '"' + value.value + '" is now ' + result.synonym.urn;
+    if (result.reconverted.length) {
+        message += ', ' + (result.reconverted.length - failed.length) + ' feed(s) converted again';
+    }
+    if (failed.length) {
+        message += ', failed: ' + failed.map((outcome) => outcome.owner + ' (' + outcome.error + ')').join(', ');
+    }
+    setStatus(message, failed.length > 0);
+    loadUnmapped();
+    loadSynonyms();
+}
+
+//------------------------------------------------------------------- Synonyms
+
+async function loadSynonyms() {
+    const response = await request('GET', 'synonyms');
+    if (!response) {
+        fillTable('synonyms', [], 'Could not load the synonyms');
+        return;
+    }
+    const synonyms = await response.json();
+    fillTable('synonyms', synonyms.map((synonym) => [
+        synonym.type_urn,
+        synonym.value,
+        synonym.urn,
+        { node: removeButton(synonym) },
+    ]), 'No synonyms yet');
+}
+
+function removeButton(synonym) {
+    const button = document.createElement('button');
+    button.className = 'link-button';
+    button.textContent = 'remove';
+    button.addEventListener('click', async () => {
+        const query = 'synonyms?type_urn=' + encodeURIComponent(synonym.type_urn) + '&value=' + encodeURIComponent(synonym.value);
+        if (await request('DELETE', query)) {
+            setStatus('Synonym removed');
+            loadUnmapped();
+            loadSynonyms();
+        }
+    });
+    return button;
+}
+
+//------------------------------------------------------------------- Helpers
+
+// Calls the mappings API; shows the error and returns null when it fails
+async function request(method, path, body) {
+    const headers = authHeaders();
+    if (body) {
+        headers['Content-Type'] = 'application/json';
+    }
+    let response;
+    try {
+        response = await fetch(mappingsEndpoint + path, { method: method, headers: headers, body: body ? JSON.stringify(body) : undefined });
+    } catch (error) {
+        setStatus('Network error', true);
+        return null;
+    }
+    if (!response.ok) {
+        let message = response.statusText;
+        try {
+            message = (await response.json()).message || message;
+        } catch (error) {
+            // Not a JSON error
+        }
+        setStatus('Request failed (' + response.status + '): ' + message, true);
+        return null;
+    }
+    return response;
+}
+
+document.getElementById('refreshButton').addEventListener('click', () => {
+    loadUnmapped();
+    loadSynonyms();
+});
+apiKeyInput.addEventListener('change', () => {
+    loadUnmapped();
+    loadSynonyms();
+});
+
+loadUnmapped();
+loadSynonyms();
@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_TIER = "default"
+
+// Buckets unused for IDLE_BUCKET_AGE are dropped once there are MAX_BUCKETS of them
+const (
+	MAX_BUCKETS     = 10000
+	IDLE_BUCKET_AGE = time.Hour
+)
+
+var (
+	ErrQueueFull    = errors.New("conversion queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting for a conversion slot")
+)
+
+// Tier is the token bucket configuration for a class of clients
+type Tier struct {
+	Rate  float64 // tokens per second
+	Burst float64
+}
+
+// ParseTiers reads "name=rate:burst,name=rate:burst", e.g. "default=0.2:5,premium=1:20"
+func ParseTiers(spec string) (map[string]Tier, error) {
+	tiers := make(map[string]Tier)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, values, found := strings.Cut(part, "=")
+		rateStr, burstStr, foundBurst := strings.Cut(values, ":")
+		if !found || !foundBurst {
+			return nil, fmt.Errorf("invalid tier '%s', expected name=rate:burst", part)
+		}
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate on tier '%s'", name)
+		}
+		burst, err := strconv.ParseFloat(burstStr, 64)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid burst on tier '%s'", name)
+		}
+		tiers[strings.TrimSpace(name)] = Tier{Rate: rate, Burst: burst}
+	}
+	if _, exists := tiers[DEFAULT_TIER]; !exists {
+		return nil, errors.New("a 'default' tier is required")
+	}
+	return tiers, nil
+}
+
+//-------------------------------------------------------------------- Token buckets
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limiter keeps one token bucket per client (API key or IP)
+type Limiter struct {
+	mu      sync.Mutex
+	tiers   map[string]Tier
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// NewLimiter creates a limiter for the given tiers
+func NewLimiter(tiers map[string]Tier) *Limiter {
+	return &Limiter{tiers: tiers, buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token for the client, or tells how long to wait for the next one
+func (l *Limiter) Allow(clientID string, tierName string) (bool, time.Duration) {
+	tier, exists := l.tiers[tierName]
+	if !exists {
+		tier = l.tiers[DEFAULT_TIER]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, exists := l.buckets[clientID]
+	if !exists {
+		l.evictIdle(now)
+		b = &bucket{tokens: tier.Burst, lastSeen: now}
+		l.buckets[clientID] = b
+	}
+
+	// Refill since the last request
+	b.tokens = math.Min(tier.Burst, b.tokens+now.Sub(b.lastSeen).Seconds()*tier.Rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / tier.Rate * float64(time.Second))
+	return false, wait
+}
+
+// evictIdle drops the buckets unused for over IDLE_BUCKET_AGE, only once there are MAX_BUCKETS,
+// so the map doesn't grow forever; a client coming back starts again with a full bucket
+func (l *Limiter) evictIdle(now time.Time) {
+	if len(l.buckets) < MAX_BUCKETS {
+		return
+	}
+	for id, b := range l.buckets {
+		if now.Sub(b.lastSeen) > IDLE_BUCKET_AGE {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+//-------------------------------------------------------------------- Concurrency
+
+// Gate caps the number of conversions running at once and queues the rest
+type Gate struct {
+	slots   chan struct{}
+	waiting chan struct{}
+	timeout time.Duration
+}
+
+// NewGate allows maxConcurrent conversions with up to queueSize waiting for timeout
+func NewGate(maxConcurrent int, queueSize int, timeout time.Duration) *Gate {
+	return &Gate{
+		slots:   make(chan struct{}, maxConcurrent),
+		waiting: make(chan struct{}, queueSize),
+		timeout: timeout,
+	}
+}
+
+// Acquire waits for a free slot; the returned function releases it
+func (g *Gate) Acquire(ctx context.Context) (func(), error) {
+	release := func() { <-g.slots }
+
+	// Fast path
+	select {
+	case g.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	// Join the queue, if there is room
+	select {
+	case g.waiting <- struct{}{}:
+		defer func() { <-g.waiting }()
+	default:
+		return nil, ErrQueueFull
+	}
+
+	timer := time.NewTimer(g.timeout)
+	defer timer.Stop()
+
+	select {
+	case g.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RetryAfter is a hint for clients rejected by the gate
+func (g *Gate) RetryAfter() time.Duration {
+	return g.timeout
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a limiter on a clock the test moves by hand
+func newTestLimiter(tiers map[string]Tier) (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(tiers)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers("default=0.2:5, premium=1:20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tiers[DEFAULT_TIER] != (Tier{Rate: 0.2, Burst: 5}) || tiers["premium"] != (Tier{Rate: 1, Burst: 20}) {
+		t.Errorf("ParseTiers = %+v", tiers)
+	}
+
+	for _, spec := range []string{"premium=1:20", "default=0:5", "default=1:0", "default=1", "default"} {
+		if _, err := ParseTiers(spec); err == nil {
+			t.Errorf("ParseTiers(%q) accepted an invalid spec", spec)
+		}
+	}
+}
+
+func TestLimiterBurst(t *testing.T) {
+	limiter, _ := newTestLimiter(map[string]Tier{DEFAULT_TIER: {Rate: 1, Burst: 3}, "premium": {Rate: 1, Burst: 5}})
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := limiter.Allow("ip:1", DEFAULT_TIER); !allowed {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+	}
+	allowed, wait := limiter.Allow("ip:1", DEFAULT_TIER)
+	if allowed || wait != time.Second {
+		t.Errorf("request over the burst = %v, %v, want rejected for 1s", allowed, wait)
+	}
+
+	// Every client has its own bucket, and an unknown tier is the default one
+	if allowed, _ := limiter.Allow("ip:2", "unknown"); !allowed {
+		t.Error("another client was rejected")
+	}
+	for i := 0; i < 5; i++ {
+		if allowed, _ := limiter.Allow("key:premium", "premium"); !allowed {
+			t.Fatalf("premium request %d rejected within its burst", i+1)
+		}
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	limiter, now := newTestLimiter(map[string]Tier{DEFAULT_TIER: {Rate: 0.5, Burst: 2}})
+
+	limiter.Allow("ip:1", DEFAULT_TIER)
+	limiter.Allow("ip:1", DEFAULT_TIER)
+	if allowed, wait := limiter.Allow("ip:1", DEFAULT_TIER); allowed || wait != 2*time.Second {
+		t.Fatalf("empty bucket = %v, %v, want rejected for 2s", allowed, wait)
+	}
+
+	// Half a token is not enough, a whole one is
+	*now = now.Add(time.Second)
+	if allowed, wait := limiter.Allow("ip:1", DEFAULT_TIER); allowed || wait != time.Second {
+		t.Errorf("after 1s = %v, %v, want rejected for 1s", allowed, wait)
+	}
+	*now = now.Add(time.Second)
+	if allowed, _ := limiter.Allow("ip:1", DEFAULT_TIER); !allowed {
+		t.Error("after 2s the refilled token was not there")
+	}
+
+	// A long pause never fills over the burst
+	*now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow("ip:1", DEFAULT_TIER); !allowed {
+			t.Fatalf("request %d rejected after the refill", i+1)
+		}
+	}
+	if allowed, _ := limiter.Allow("ip:1", DEFAULT_TIER); allowed {
+		t.Error("bucket refilled over its burst")
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	limiter, now := newTestLimiter(map[string]Tier{DEFAULT_TIER: {Rate: 1, Burst: 1}})
+	for i := 0; i < MAX_BUCKETS-1; i++ {
+		limiter.Allow("ip:"+strconv.Itoa(i), DEFAULT_TIER)
+	}
+	*now = now.Add(IDLE_BUCKET_AGE + time.Second)
+	limiter.Allow("ip:recent", DEFAULT_TIER)
+	limiter.Allow("ip:new", DEFAULT_TIER)
+
+	if len(limiter.buckets) != 2 {
+		t.Errorf("%d buckets left, want only the two recent ones", len(limiter.buckets))
+	}
+}
+
+func TestGateQueue(t *testing.T) {
+	gate := NewGate(1, 1, 50*time.Millisecond)
+
+	release, err := gate.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The only queue place is taken by a waiter, the next one is turned away
+	waiting := make(chan error)
+	go func() {
+		_, err := gate.Acquire(context.Background())
+		waiting <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := gate.Acquire(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Acquire with a full queue = %v, want ErrQueueFull", err)
+	}
+
+	// The waiter gives up when no slot frees in time
+	if err := <-waiting; !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("queued Acquire = %v, want ErrQueueTimeout", err)
+	}
+
+	// Released slots are taken by the queue
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	next, err := gate.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire after release = %v", err)
+	}
+	next()
+}
+
+func TestGateCancel(t *testing.T) {
+	gate := NewGate(1, 1, time.Minute)
+	release, _ := gate.Acquire(context.Background())
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := gate.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Acquire on a canceled request = %v, want context.Canceled", err)
+	}
+}
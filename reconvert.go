@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-test/convert_to_json"
+	"go-test/convert_to_rosetta"
+	"go-test/history"
+	"go-test/report"
+	"log/slog"
+	"os"
+)
+
+// parseFeed turns the uncompressed XML feed into the JSON map the Rosetta conversion works on
+func parseFeed(content []byte, conversionReport *report.Report) (map[string]interface{}, error) {
+	jsonData, err := convert_to_json.ConvertXMLToJSON(content, conversionReport)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		return nil, fmt.Errorf("Error decoding JSON: %v", err)
+	}
+	return result, nil
+}
+
+// reconvertOwner converts again the last published upload of the owner, with the mappings as they are now
+func reconvertOwner(owner string, logger *slog.Logger) (history.Entry, error) {
+	entries, err := conversionHistory.List(owner)
+	if err != nil {
+		return history.Entry{}, err
+	}
+	var last *history.Entry
+	for i := range entries {
+		if !entries[i].DryRun {
+			last = &entries[i]
+			break
+		}
+	}
+	if last == nil {
+		return history.Entry{}, fmt.Errorf("no published conversion for '%s'", owner)
+	}
+
+	inputPath, err := conversionHistory.FilePath(owner, last.ID, history.FILE_INPUT)
+	if err != nil {
+		return history.Entry{}, err
+	}
+	compressedContent, err := os.ReadFile(inputPath)
+	if err != nil {
+		return history.Entry{}, err
+	}
+	decompressedContent, decompressError := readDecompressed(compressedContent, serverConfig)
+	if decompressError != nil {
+		return history.Entry{}, decompressError
+	}
+
+	// Keep the validation mode the agency used
+	strict := serverConfig.StrictValidation
+	if lastReport, err := readHistoryReport(owner, last.ID); err == nil {
+		strict = lastReport.StrictValidation
+	}
+
+	conversionReport := report.New()
+	result, err := parseFeed(decompressedContent, conversionReport)
+	if err != nil {
+		return history.Entry{}, err
+	}
+
+	ownerEmail := convert_to_rosetta.ConvertOwnerEmail(result)
+	rosettaXML, err := convert_to_rosetta.ConvertJSONToRosetta(result, convert_to_rosetta.Options{
+		Logger:           logger,
+		Report:           conversionReport,
+		StrictValidation: strict,
+		Pretty:           serverConfig.PrettyOutput,
+		ImageClient:      imageClient,
+		Mirror:           imageMirror,
+	})
+	if err != nil {
+		return history.Entry{}, err
+	}
+
+	outputPath, err := convertedFilePath(ownerEmail)
+	if err != nil {
+		return history.Entry{}, err
+	}
+	if err := SaveNewXml(rosettaXML, outputPath); err != nil {
+		return history.Entry{}, err
+	}
+	return conversionHistory.Record(ownerEmail, compressedContent, rosettaXML, conversionReport)
+}
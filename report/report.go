@@ -0,0 +1,98 @@
+package report
+
+const (
+	LEVEL_ERROR   = "error"
+	LEVEL_WARNING = "warning"
+	LEVEL_INFO    = "info"
+)
+
+// Issue is one finding about the feed, the agency or a single advert
+type Issue struct {
+	Level      string `json:"level"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Field      string `json:"field,omitempty"`
+	Value      string `json:"value,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+// Report collects everything worth telling the agency about one conversion
+type Report struct {
+	// History entry of the conversion and its owner, to download its files later
+	ConversionID string `json:"conversion_id,omitempty"`
+	Owner        string `json:"owner,omitempty"`
+
+	// Character encoding detected for the uploaded feed and how it was found
+	Encoding       string `json:"encoding"`
+	EncodingSource string `json:"encoding_source"`
+
+	// SHA-256 of the canonical (compact) Rosetta output
+	OutputSHA256 string `json:"output_sha256,omitempty"`
+
+	// Nothing was written, the report is all there is
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Invalid adverts were left out
+	StrictValidation bool `json:"strict_validation,omitempty"`
+
+	// Adverts found in the feed, rejected ones included
+	AdvertCount int `json:"advert_count"`
+
+	// Category resolved for each advert (dry run only)
+	Categories []CategoryResolution `json:"categories,omitempty"`
+
+	// First converted adverts, as they would be written (dry run only)
+	Preview []string `json:"preview,omitempty"`
+
+	// Adverts dropped from the output (strict validation...)
+	RejectedAdverts []string `json:"rejected_adverts,omitempty"`
+
+	Issues []Issue `json:"issues"`
+}
+
+// CategoryResolution tells which category URN an advert ended up with, "" when none matched
+type CategoryResolution struct {
+	ExternalID string  `json:"external_id"`
+	OfferType  string  `json:"offer_type"`
+	Category   string  `json:"category"`
+	URN        string  `json:"urn"`
+	Confidence float64 `json:"confidence"`
+	Source     string  `json:"source"` // category, keywords or offer_type
+}
+
+// New creates an empty conversion report
+func New() *Report {
+	return &Report{Issues: []Issue{}}
+}
+
+// Add appends an issue; a nil report ignores it so callers don't have to check
+func (r *Report) Add(issue Issue) {
+	if r == nil {
+		return
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// Reject records an advert left out of the output
+func (r *Report) Reject(externalID string) {
+	if r == nil {
+		return
+	}
+	r.RejectedAdverts = append(r.RejectedAdverts, externalID)
+}
+
+// AddCategory records the category resolved for one advert
+func (r *Report) AddCategory(resolution CategoryResolution) {
+	if r == nil {
+		return
+	}
+	r.Categories = append(r.Categories, resolution)
+}
+
+// AddPreview keeps one converted advert for the preview
+func (r *Report) AddPreview(advertXML string) {
+	if r == nil {
+		return
+	}
+	r.Preview = append(r.Preview, advertXML)
+}
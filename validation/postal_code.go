@@ -0,0 +1,131 @@
+package validation
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var postalCodePattern = regexp.MustCompile(`^(\d{4})\s*[-‐–]?\s*(\d{3})$`)
+
+// cp4Ranges is the bundled dataset: CP4 ranges in use and their district
+//
+//go:embed data/cp4_ranges.txt
+var cp4Ranges string
+
+type cp4Range struct {
+	from     int
+	to       int
+	district string
+}
+
+var (
+	datasetOnce sync.Once
+	ranges      []cp4Range
+
+	// Full CP7 list, only when loaded with LoadPostalCodes
+	cp7Mu    sync.RWMutex
+	cp7Codes map[string]bool
+)
+
+// NormalizePostalCode returns the CP7 in the NNNN-NNN format, or "" when it can't be read
+func NormalizePostalCode(postalCode string) string {
+	match := postalCodePattern.FindStringSubmatch(strings.TrimSpace(postalCode))
+	if match == nil {
+		return ""
+	}
+	return match[1] + "-" + match[2]
+}
+
+// PostalCodeExists checks a normalized CP7: against the full list when loaded, against the CP4 ranges otherwise
+func PostalCodeExists(postalCode string) bool {
+	cp7Mu.RLock()
+	codes := cp7Codes
+	cp7Mu.RUnlock()
+	if codes != nil {
+		return codes[postalCode]
+	}
+	return PostalCodeDistrict(postalCode) != ""
+}
+
+// HasFullPostalCodes tells if the CP7 list is loaded; without it a miss only means the CP4 ranges don't know the code
+func HasFullPostalCodes() bool {
+	cp7Mu.RLock()
+	defer cp7Mu.RUnlock()
+	return cp7Codes != nil
+}
+
+// PostalCodeDistrict returns the district of the CP4 part using the bundled dataset
+func PostalCodeDistrict(postalCode string) string {
+	datasetOnce.Do(loadRanges)
+
+	if len(postalCode) < 4 {
+		return ""
+	}
+	cp4, err := strconv.Atoi(postalCode[:4])
+	if err != nil {
+		return ""
+	}
+	for _, r := range ranges {
+		if cp4 >= r.from && cp4 <= r.to {
+			return r.district
+		}
+	}
+	return ""
+}
+
+// LoadPostalCodes loads a full CP7 list (one NNNN-NNN per line, extra columns ignored) for exact checks
+func LoadPostalCodes(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return loadPostalCodes(file)
+}
+
+func loadPostalCodes(reader io.Reader) error {
+	codes := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.FieldsFunc(scanner.Text(), func(r rune) bool { return r == ';' || r == ',' || r == '\t' })
+		if len(fields) == 0 {
+			continue
+		}
+		if code := NormalizePostalCode(fields[0]); code != "" {
+			codes[code] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	cp7Mu.Lock()
+	cp7Codes = codes
+	cp7Mu.Unlock()
+	return nil
+}
+
+func loadRanges() {
+	for _, line := range strings.Split(cp4Ranges, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ";", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		from, errFrom := strconv.Atoi(fields[0])
+		to, errTo := strconv.Atoi(fields[1])
+		if errFrom != nil || errTo != nil {
+			continue
+		}
+		ranges = append(ranges, cp4Range{from: from, to: to, district: fields[2]})
+	}
+}
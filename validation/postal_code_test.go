@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizePostalCode(t *testing.T) {
+	tests := []struct {
+		postalCode string
+		want       string
+	}{
+		{"4000-123", "4000-123"},
+		{" 4000 123 ", "4000-123"},
+		{"4000123", "4000-123"},
+		{"4000–123", "4000-123"},
+
+		{"400-123", ""},
+		{"4000", ""},
+		{"4000-12a", ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizePostalCode(test.postalCode); got != test.want {
+			t.Errorf("NormalizePostalCode(%q) = %q, want %q", test.postalCode, got, test.want)
+		}
+	}
+}
+
+func TestPostalCodeDistrict(t *testing.T) {
+	tests := []struct {
+		postalCode string
+		want       string
+	}{
+		{"1000-001", "Lisboa"},
+		{"4000-123", "Porto"},
+		{"6400-222", "Guarda"}, // Pinhel
+		{"6420-001", "Guarda"}, // Trancoso
+		{"9000-018", "Madeira"},
+		{"9400-010", "Madeira"}, // Porto Santo
+		{"9500-150", "Açores"},
+
+		{"0999-000", ""},
+		{"5600-000", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := PostalCodeDistrict(test.postalCode); got != test.want {
+			t.Errorf("PostalCodeDistrict(%q) = %q, want %q", test.postalCode, got, test.want)
+		}
+	}
+}
+
+func TestPostalCodeExistsWithFullList(t *testing.T) {
+	if HasFullPostalCodes() || !PostalCodeExists("4000-999") {
+		t.Fatal("without the CP7 list every code inside a CP4 range should exist")
+	}
+
+	if err := loadPostalCodes(strings.NewReader("4000-123;Porto\n4000 124\tPorto\n\nnot a code\n")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cp7Codes = nil })
+
+	if !HasFullPostalCodes() {
+		t.Error("HasFullPostalCodes is false after loading the list")
+	}
+	for postalCode, want := range map[string]bool{"4000-123": true, "4000-124": true, "4000-999": false} {
+		if got := PostalCodeExists(postalCode); got != want {
+			t.Errorf("PostalCodeExists(%q) = %v, want %v", postalCode, got, want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// Plain addresses only: no quotes, comments or path characters on either side
+	emailPattern = regexp.MustCompile(`^[a-z0-9_%+-]+(?:\.[a-z0-9_%+-]+)*@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}$`)
+
+	amiPattern = regexp.MustCompile(`^(?:AMI)?\s*(?:N\.?[ºO°]?\s*)?(\d{1,6})$`)
+
+	// "123/2005", "Alvará n.º 123/2005", "Licença de utilização nº 45-07"...
+	licencePattern = regexp.MustCompile(`(?i)^(?:(?:alvar[aá]|licen[cç]a|de|utiliza[cç][aã]o|lu|n[uú]mero|n\.?[ºo°]?|[:.#])\s*)*(\d{1,6})(?:\s*[/-]\s*(\d{2}|\d{4}))?$`)
+)
+
+//-------------------------------------------------------------------- NIF
+
+// NormalizeNIF removes spaces, dots and the PT prefix from a tax ID
+func NormalizeNIF(nif string) string {
+	nif = strings.ToUpper(strings.TrimSpace(nif))
+	nif = strings.TrimPrefix(nif, "PT")
+	return strings.Map(func(r rune) rune {
+		if '0' <= r && r <= '9' {
+			return r
+		}
+		return -1
+	}, nif)
+}
+
+// ValidNIF checks a Portuguese NIF/NIPC: 9 digits, a known prefix and the mod 11 check digit
+func ValidNIF(nif string) bool {
+	nif = NormalizeNIF(nif)
+	if len(nif) != 9 {
+		return false
+	}
+
+	if !strings.ContainsAny(nif[:1], "1235689") && !hasAnyPrefix(nif, "45", "70", "71", "72", "74", "75", "77", "79", "90", "91", "98", "99") {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < 8; i++ {
+		sum += int(nif[i]-'0') * (9 - i)
+	}
+	checkDigit := 11 - sum%11
+	if checkDigit >= 10 {
+		checkDigit = 0
+	}
+
+	return checkDigit == int(nif[8]-'0')
+}
+
+//-------------------------------------------------------------------- AMI
+
+// NormalizeAMI returns the bare AMI licence number, or "" when the format is wrong
+func NormalizeAMI(ami string) string {
+	match := amiPattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(ami)))
+	if match == nil {
+		return ""
+	}
+	number := strings.TrimLeft(match[1], "0")
+	if number == "" {
+		return ""
+	}
+	return number
+}
+
+// ValidAMI checks the format of an IMPIC mediation licence number ("AMI 12345", "12345")
+func ValidAMI(ami string) bool {
+	return NormalizeAMI(ami) != ""
+}
+
+//-------------------------------------------------------------------- Licence
+
+// IsExemptLicence tells if the value is the "Isento" (exempt) marker
+func IsExemptLicence(licence string) bool {
+	return strings.EqualFold(strings.TrimSpace(licence), "isento")
+}
+
+// NormalizeUserLicence returns "number" or "number/year" from the free text, or "" when invalid
+func NormalizeUserLicence(licence string) string {
+	match := licencePattern.FindStringSubmatch(strings.TrimSpace(licence))
+	if match == nil {
+		return ""
+	}
+	if match[2] == "" {
+		return match[1]
+	}
+	return match[1] + "/" + match[2]
+}
+
+// ValidUserLicence accepts "Isento" or a well formed licence number
+func ValidUserLicence(licence string) bool {
+	return IsExemptLicence(licence) || NormalizeUserLicence(licence) != ""
+}
+
+//-------------------------------------------------------------------- Phone
+
+// NormalizePhone returns the number in E.164 ("+351912345678"), or "" when it is not a phone number.
+// Numbers without a country code are Portuguese: 9 digits starting with 2 (landline), 9 (mobile), 3 or 8 (nomadic and special).
+func NormalizePhone(phone string) string {
+	// "(+351) 912..." is international too: the + only counts before the first digit
+	phone = strings.TrimLeft(phone, " \t(")
+	international := strings.HasPrefix(phone, "+")
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case '0' <= r && r <= '9':
+			return r
+		case strings.ContainsRune(" .-/()", r):
+			return -1
+		}
+		return 'x'
+	}, strings.TrimPrefix(phone, "+"))
+	if strings.Contains(digits, "x") || digits == "" {
+		return ""
+	}
+
+	if !international && strings.HasPrefix(digits, "00") {
+		digits = digits[2:]
+		international = true
+	}
+	if !international && len(digits) == 9 {
+		digits = "351" + digits
+	} else if !international && !(len(digits) == 12 && strings.HasPrefix(digits, "351")) {
+		return ""
+	}
+
+	// Portuguese numbers have 9 digits after the country code
+	if strings.HasPrefix(digits, "351") && (len(digits) != 12 || !strings.ContainsAny(digits[3:4], "2389")) {
+		return ""
+	}
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return ""
+	}
+	return "+" + digits
+}
+
+//-------------------------------------------------------------------- Email
+
+// NormalizeEmail returns the address trimmed and lowercased, or "" when it is not a plain email address
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > 254 || !emailPattern.MatchString(email) {
+		return ""
+	}
+	return email
+}
+
+//-------------------------------------------------------------------- Helpers
+
+func hasAnyPrefix(value string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
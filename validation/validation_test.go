@@ -0,0 +1,129 @@
+package validation
+
+import "testing"
+
+func TestNormalizeNIF(t *testing.T) {
+	tests := map[string]string{
+		"PT 123 456 789": "123456789",
+		"123.456.789":    "123456789",
+		"12345678٩":      "12345678",
+		"１２３４５６７８９":      "",
+	}
+
+	for nif, want := range tests {
+		if got := NormalizeNIF(nif); got != want {
+			t.Errorf("NormalizeNIF(%q) = %q, want %q", nif, got, want)
+		}
+	}
+}
+
+func TestValidNIF(t *testing.T) {
+	tests := []struct {
+		nif  string
+		want bool
+	}{
+		{"123456789", true},
+		{"PT 123 456 789", true},
+		{"123.456.789", true},
+		{"450000001", true}, // 45 prefix, check digit 1
+
+		{"123456780", false}, // wrong check digit
+		{"400000008", false}, // right check digit, 4 is not a known prefix
+		{"12345678", false},
+		{"1234567890", false},
+		{"", false},
+		{"1234567٩", false}, // 9 bytes with the Arabic-Indic 9, never read as digits
+	}
+
+	for _, test := range tests {
+		if got := ValidNIF(test.nif); got != test.want {
+			t.Errorf("ValidNIF(%q) = %v, want %v", test.nif, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeAMI(t *testing.T) {
+	tests := []struct {
+		ami  string
+		want string
+	}{
+		{"AMI 12345", "12345"},
+		{"12345", "12345"},
+		{"ami 7310", "7310"},
+		{"AMI N.º 00123", "123"},
+		{"AMI nº 4567", "4567"},
+
+		{"0000", ""},
+		{"AMI", ""},
+		{"AMI 1234567", ""},
+		{"licença 123", ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeAMI(test.ami); got != test.want {
+			t.Errorf("NormalizeAMI(%q) = %q, want %q", test.ami, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeUserLicence(t *testing.T) {
+	tests := []struct {
+		licence string
+		want    string
+		valid   bool
+	}{
+		{"123/2005", "123/2005", true},
+		{"Alvará n.º 123/2005", "123/2005", true},
+		{"Licença de utilização nº 45-07", "45/07", true},
+		{"LU 9876", "9876", true},
+		{"Isento", "", true},
+		{" isento ", "", true},
+
+		{"sem licença", "", false},
+		{"123/5", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeUserLicence(test.licence); got != test.want {
+			t.Errorf("NormalizeUserLicence(%q) = %q, want %q", test.licence, got, test.want)
+		}
+		if got := ValidUserLicence(test.licence); got != test.valid {
+			t.Errorf("ValidUserLicence(%q) = %v, want %v", test.licence, got, test.valid)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		// Portuguese numbers, with or without the country code
+		{"912345678", "+351912345678"},
+		{"912 345 678", "+351912345678"},
+		{"+351 220 000 000", "+351220000000"},
+		{"00351 912-345-678", "+351912345678"},
+		{"351912345678", "+351912345678"},
+		{"(+351) 808 200 300", "+351808200300"},
+
+		// Foreign numbers keep their country code
+		{"+34 612 345 678", "+34612345678"},
+		{"0044 20 7946 0958", "+442079460958"},
+
+		// Not phone numbers
+		{"", ""},
+		{"12345", ""},
+		{"512345678", ""},
+		{"+351 91234567", ""},
+		{"912345678 ext. 2", ""},
+		{"geral@arhome.pt", ""},
+		{"٩١٢٣٤٥٦٧٨", ""}, // Arabic-Indic digits are not dialable
+	}
+
+	for _, test := range tests {
+		if got := NormalizePhone(test.phone); got != test.want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", test.phone, got, test.want)
+		}
+	}
+}
@@ -1,28 +1,99 @@
 package main
 
 import (
-	"compress/gzip"
+	"embed"
+	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
+	"go-test/auth"
 	"go-test/convert_to_json"
 	"go-test/convert_to_rosetta"
+	"go-test/history"
+	"go-test/logging"
+	"go-test/metrics"
+	"go-test/mirror"
+	"go-test/ratelimit"
+	"go-test/report"
+	"go-test/validation"
 )
 
+var serverConfig = LoadConfig()
+
+var keyStore *auth.Store
+
+var rateLimiter *ratelimit.Limiter
+
+var conversionGate *ratelimit.Gate
+
+var conversionHistory *history.Store
+
+// Sends the image HEAD checks, nil when CONVERT_CHECK_IMAGES is off
+var imageClient convert_to_rosetta.HTTPClient
+
+// Copies the images to our storage, nil when CONVERT_MIRROR_IMAGES is off
+var imageMirror *mirror.Mirror
+
+// Dashboard and docs, built into the binary
+//
+//go:embed public
+var publicFiles embed.FS
+
 func xmlHandler(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	// Identify the caller before reading anything
+	var apiKey *auth.APIKey
+	if serverConfig.AuthEnabled {
+		key, err := keyStore.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, &apiError{Status: http.StatusUnauthorized, Code: ERR_UNAUTHORIZED, Message: err.Error()})
+			return
+		}
+		apiKey = key
+	}
+
+	// Per client token bucket: the key when there is one, the IP otherwise
+	clientID, tier := clientIdentity(r, apiKey)
+	if allowed, retryAfter := rateLimiter.Allow(clientID, tier); !allowed {
+		writeRetryError(w, &apiError{Status: http.StatusTooManyRequests, Code: ERR_RATE_LIMITED, Message: "Too many conversions, slow down"}, retryAfter)
+		return
+	}
+
+	// Never accept more than the configured compressed size
+	r.Body = http.MaxBytesReader(w, r.Body, serverConfig.MaxCompressedBytes)
+
 	file, _, err := r.FormFile("file")
 	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			writeError(w, &apiError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Code:    ERR_UPLOAD_TOO_LARGE,
+				Message: fmt.Sprintf("Upload exceeds %d bytes", serverConfig.MaxCompressedBytes),
+			})
+			return
+		}
 		http.Error(w, "Error getting file", http.StatusInternalServerError)
 		return
 	}
@@ -33,24 +104,36 @@ func xmlHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error reading the file", http.StatusInternalServerError)
 		return
 	}
+	metrics.BytesIn.Add(float64(len(compressedContent)))
 
-	// Creating a Gzip reader from compressed content
-	reader, err := gzip.NewReader(bytes.NewReader(compressedContent))
+	// Global cap on conversions running at once, taken once the upload is in so slow clients hold no slot,
+	// and before the decompression since that is the memory the cap bounds
+	release, err := conversionGate.Acquire(r.Context())
 	if err != nil {
-		http.Error(w, "Error creating Gzip reader", http.StatusInternalServerError)
+		writeRetryError(w, &apiError{Status: http.StatusServiceUnavailable, Code: ERR_SERVER_BUSY, Message: err.Error()}, conversionGate.RetryAfter())
 		return
 	}
-	defer reader.Close()
+	defer release()
 
-	// Reading uncompressed content
-	decompressedContent, err := io.ReadAll(reader)
-	if err != nil {
-		http.Error(w, "Error reading uncompressed content", http.StatusInternalServerError)
+	// Reading uncompressed content within the size and ratio limits
+	stageStart := time.Now()
+	decompressedContent, decompressError := readDecompressed(compressedContent, serverConfig)
+	metrics.StageDuration.ObserveSince(stageStart, "decompress")
+	if decompressError != nil {
+		writeError(w, decompressError)
 		return
 	}
 
+	conversionReport := report.New()
+
 	// Adding a log to check the uncompressed XMLo
-	jsonData, err := convert_to_json.ConvertXMLToJSON(decompressedContent)
+	stageStart = time.Now()
+	jsonData, err := convert_to_json.ConvertXMLToJSON(decompressedContent, conversionReport)
+	var xmlLimitError *convert_to_json.XMLLimitError
+	if errors.As(err, &xmlLimitError) {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: ERR_XML_TOO_COMPLEX, Message: xmlLimitError.Error()})
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error converting to JSON: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -62,50 +145,265 @@ func xmlHandler(w http.ResponseWriter, r *http.Request) {
 	// Decoding JSON to the map
 	err2 := json.Unmarshal([]byte(jsonData), &result)
 	if err2 != nil {
-		fmt.Println("Error decoding JSON:", err2)
+		logger.Error("error decoding JSON", "error", err2)
+		http.Error(w, "Error decoding JSON", http.StatusInternalServerError)
+		return
+	}
+	metrics.StageDuration.ObserveSince(stageStart, "parse")
+
+	// Get owner as the name to write to file
+	ownerEmail := convert_to_rosetta.ConvertOwnerEmail(result)
+	logger.Info("converting feed", "owner", ownerEmail)
+
+	// The key must be bound to the owner of the feed
+	if apiKey != nil && !apiKey.Authorizes(ownerEmail) {
+		writeError(w, &apiError{
+			Status:  http.StatusForbidden,
+			Code:    ERR_OWNER_NOT_ALLOWED,
+			Message: "API key is not allowed to convert feeds for '" + ownerEmail + "'",
+		})
 		return
 	}
 
+	// A dry run goes through the whole conversion but never touches the converted files
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	previewAdverts := serverConfig.DryRunPreview
+	if preview, err := strconv.Atoi(r.URL.Query().Get("preview")); err == nil && preview >= 0 {
+		previewAdverts = preview
+	}
+
+	// The converted file is named after the owner email, so it must be one
+	var outputPath string
+	if !dryRun {
+		outputPath, err = convertedFilePath(ownerEmail)
+		if err != nil {
+			writeError(w, &apiError{Status: http.StatusUnprocessableEntity, Code: ERR_INVALID_OWNER, Message: err.Error()})
+			return
+		}
+	}
+
 	// Converting to Rosetta
-	rosettaXML, err := convert_to_rosetta.ConvertJSONToRosetta(result, w) // Assuming 'result' is your decoded JSON map
+	stageStart = time.Now()
+	rosettaXML, err := convert_to_rosetta.ConvertJSONToRosetta(result, convert_to_rosetta.Options{ // Assuming 'result' is your decoded JSON map
+		Logger:           logger,
+		Report:           conversionReport,
+		StrictValidation: serverConfig.StrictValidation || r.URL.Query().Get("strict") == "true",
+		Pretty:           serverConfig.PrettyOutput || r.URL.Query().Get("pretty") == "true",
+		DryRun:           dryRun,
+		PreviewAdverts:   previewAdverts,
+		ImageClient:      imageClient,
+		Mirror:           imageMirror,
+	})
+	metrics.StageDuration.ObserveSince(stageStart, "map")
 	if err != nil {
 		http.Error(w, "Error converting to Rosetta: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Get owner as the name to write to file
-	ownerEmail := convert_to_rosetta.ConvertOwnerEmail(result)
-	fmt.Println("Owner Email:", ownerEmail)
+	if dryRun {
+		// Keep the upload, the output and the report for the dashboard
+		if _, err := conversionHistory.Record(ownerEmail, compressedContent, rosettaXML, conversionReport); err != nil {
+			logger.Error("error recording conversion history", "owner", ownerEmail, "error", err)
+		}
+		logger.Info("dry run, nothing written", "owner", ownerEmail, "adverts", conversionReport.AdvertCount)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(conversionReport)
+		return
+	}
 
-	err3 := SaveNewXml(rosettaXML, "converted/"+ownerEmail+".xml")
+	stageStart = time.Now()
+	err3 := SaveNewXml(rosettaXML, outputPath)
+	metrics.StageDuration.ObserveSince(stageStart, "write")
 	if err3 != nil {
-		// error
+		// The agency must not believe the feed is published
+		logger.Error("error writing converted feed", "owner", ownerEmail, "error", err3)
+		writeError(w, &apiError{Status: http.StatusInternalServerError, Code: ERR_WRITE_FAILED, Message: "Error writing the converted feed, it was not published"})
+		return
+	}
+	metrics.BytesOut.Add(float64(len(rosettaXML)))
+	// Only the adverts on the published feed, not the rejected ones
+	metrics.AdvertsConverted.Add(float64(conversionReport.AdvertCount - len(conversionReport.RejectedAdverts)))
+
+	// Recorded once written, so the history never shows a feed as published when it is not; reconversions
+	// start from the newest published entry, which pruning keeps whatever the dry runs after it
+	if _, err := conversionHistory.Record(ownerEmail, compressedContent, rosettaXML, conversionReport); err != nil {
+		logger.Error("error recording conversion history", "owner", ownerEmail, "error", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversionReport)
+}
+
+// clientIdentity returns who is calling and the rate limit tier that applies
+func clientIdentity(r *http.Request, apiKey *auth.APIKey) (string, string) {
+	if apiKey != nil {
+		return "key:" + apiKey.ID, apiKey.Tier
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host, ratelimit.DEFAULT_TIER
+}
+
+// convertedFilePath is converted/<owner>.xml with the owner email lowercased, whatever case the feed uses
+func convertedFilePath(ownerEmail string) (string, error) {
+	email := validation.NormalizeEmail(ownerEmail)
+	if email == "" {
+		return "", fmt.Errorf("owner email '%s' is missing or not valid", ownerEmail)
+	}
+	return filepath.Join("converted", email+".xml"), nil
 }
 
 func SaveNewXml(rosettaXML string, filePath string) error {
 	// Write content to file
 	err := ioutil.WriteFile(filePath, []byte(rosettaXML), 0644)
 	if err != nil {
-		fmt.Println("Error writing to file:", err)
 		return err
 	}
-	fmt.Println("Content saved with success!")
+	slog.Debug("content saved with success", "path", filePath)
+	return nil
+}
+
+// Element names the operators may configure
+var xmlNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// loadMappingData applies the registry, postal code list and XML limits configured by the operators
+func loadMappingData(config Config) error {
+	// Attribute kinds configured by the operators
+	if config.AttributesFile != "" {
+		if err := convert_to_rosetta.LoadAttributeRegistry(config.AttributesFile); err != nil {
+			return fmt.Errorf("Error loading attribute registry: %v", err)
+		}
+	}
+
+	// Values mapped by the operators on the mapping editor
+	if err := convert_to_rosetta.LoadSynonyms(config.SynonymsFile); err != nil {
+		return fmt.Errorf("Error loading synonyms: %v", err)
+	}
+
+	// Offer type values (and codes) some agencies send besides the built in ones
+	if config.OfferTypesFile != "" {
+		if err := convert_to_rosetta.LoadOfferTypes(config.OfferTypesFile); err != nil {
+			return fmt.Errorf("Error loading offer types: %v", err)
+		}
+	}
+
+	// Exact postal code checks need the full CTT list
+	if config.PostalCodesFile != "" {
+		if err := validation.LoadPostalCodes(config.PostalCodesFile); err != nil {
+			return fmt.Errorf("Error loading postal codes: %v", err)
+		}
+	}
+
+	convert_to_rosetta.CategoryMinConfidence = config.CategoryMinConfidence
+	convert_to_rosetta.MaxImages = config.MaxImages
+	if config.VirtualTourElement != "" && !xmlNamePattern.MatchString(config.VirtualTourElement) {
+		return fmt.Errorf("CONVERT_VIRTUAL_TOUR_ELEMENT '%s' is not an element name", config.VirtualTourElement)
+	}
+	convert_to_rosetta.VirtualTourElement = config.VirtualTourElement
+
+	// Title and description cleanup
+	if config.DescriptionFormat != convert_to_rosetta.TEXT_FORMAT_HTML && config.DescriptionFormat != convert_to_rosetta.TEXT_FORMAT_PLAIN {
+		return fmt.Errorf("CONVERT_DESCRIPTION_FORMAT '%s' is not html or text", config.DescriptionFormat)
+	}
+	convert_to_rosetta.Text = convert_to_rosetta.TextRules{
+		DescriptionFormat:    config.DescriptionFormat,
+		AllowedTags:          strings.Split(config.DescriptionTags, ","),
+		RedactContacts:       config.RedactContacts,
+		MaxTitleLength:       config.MaxTitleLength,
+		MaxDescriptionLength: config.MaxDescriptionLength,
+	}
+	if config.CheckImages {
+		imageClient = mirror.SafeClient(config.ImageCheckTimeout)
+	}
+
+	convert_to_json.MaxXMLDepth = config.MaxXMLDepth
+	convert_to_json.MaxXMLElements = config.MaxXMLElements
 	return nil
 }
 
 func main() {
-	http.HandleFunc("/convert", xmlHandler)
+	// Key management CLI: go-test keys issue|revoke|list
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		os.Exit(runKeysCommand(os.Args[2:]))
+	}
 
-	// Serve static docs
-	fs := http.FileServer(http.Dir("./public"))
-	http.Handle("/", fs)
+	// Feed check CLI: go-test dry-run [-strict] [-preview n] <feed.xml[.gz]>
+	if len(os.Args) > 1 && os.Args[1] == "dry-run" {
+		os.Exit(runDryRunCommand(os.Args[2:]))
+	}
+
+	if _, err := logging.Setup(serverConfig.Logging); err != nil {
+		fmt.Println("Error setting up logging:", err)
+		os.Exit(1)
+	}
+
+	store, err := auth.NewStore(serverConfig.KeysFile)
+	if err != nil {
+		slog.Error("error loading API keys", "error", err)
+		os.Exit(1)
+	}
+	keyStore = store
+
+	tiers, err := ratelimit.ParseTiers(serverConfig.RateTiers)
+	if err != nil {
+		slog.Error("invalid CONVERT_RATE_TIERS", "error", err)
+		os.Exit(1)
+	}
+	rateLimiter = ratelimit.NewLimiter(tiers)
+
+	if err := loadMappingData(serverConfig); err != nil {
+		slog.Error("error loading mapping data", "error", err)
+		os.Exit(1)
+	}
+	conversionGate = ratelimit.NewGate(serverConfig.MaxConcurrent, serverConfig.QueueSize, serverConfig.QueueTimeout)
+
+	conversionHistory, err = history.NewStore(serverConfig.HistoryDir, serverConfig.HistoryKeep)
+	if err != nil {
+		slog.Error("error opening conversion history", "error", err)
+		os.Exit(1)
+	}
+
+	if serverConfig.MirrorImages {
+		imageMirror, err = mirror.New(mirror.Config{
+			Dir:             serverConfig.MirrorDir,
+			BaseURL:         serverConfig.MirrorBaseURL,
+			Concurrency:     serverConfig.MirrorConcurrency,
+			MaxBytes:        serverConfig.MirrorMaxBytes,
+			ThumbnailWidths: serverConfig.MirrorThumbnailWidths,
+			RevalidateAfter: serverConfig.MirrorRevalidateAfter,
+			Client:          mirror.SafeClient(serverConfig.MirrorTimeout),
+		})
+		if err != nil {
+			slog.Error("error setting up the image mirror", "error", err)
+			os.Exit(1)
+		}
+		http.Handle("/images/", http.StripPrefix("/images", imageMirror.Handler()))
+	}
+
+	http.HandleFunc("/convert", withRequestLogger(instrumentConversions(xmlHandler)))
+	http.Handle("/metrics", requireAdmin(metrics.Handler()))
+
+	http.HandleFunc("/history", withRequestLogger(historyHandler))
+	http.HandleFunc("/history/", withRequestLogger(historyHandler))
+	http.HandleFunc("/mappings/", withRequestLogger(mappingHandler))
+
+	// Serve the dashboard
+	public, _ := fs.Sub(publicFiles, "public")
+	http.Handle("/", http.FileServer(http.FS(public)))
+
+	server := &http.Server{
+		Addr:              serverConfig.Addr,
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
+	}
 
-	fmt.Println("Server running on port 8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		fmt.Println(err)
+	slog.Info("server running", "addr", serverConfig.Addr)
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("server stopped", "error", err)
 	}
 
 }
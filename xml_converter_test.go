@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestConvertedFilePath checks the owner email can never name a file outside converted/
+func TestConvertedFilePath(t *testing.T) {
+	tests := []struct {
+		owner string
+		want  string
+	}{
+		{"geral@arhome.pt", filepath.Join("converted", "geral@arhome.pt.xml")},
+		{" Geral@ARHome.pt ", filepath.Join("converted", "geral@arhome.pt.xml")},
+		{"", ""},
+		{"../../etc/passwd", ""},
+		{"../x@arhome.pt", ""},
+		{"a/b@arhome.pt", ""},
+		{`a\b@arhome.pt`, ""},
+		{"geral@arhome.pt/../../x", ""},
+		{"geral@..", ""},
+	}
+
+	for _, test := range tests {
+		got, err := convertedFilePath(test.owner)
+		if got != test.want || (err == nil) != (test.want != "") {
+			t.Errorf("convertedFilePath(%q) = %q, %v, want %q", test.owner, got, err, test.want)
+		}
+	}
+}